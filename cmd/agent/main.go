@@ -3,14 +3,18 @@ package main
 import (
 	"context"
 	"os/signal"
+	"sync"
 	"syscall"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	grpcclient "github.com/ulixes-bloom/ya-metrics/internal/agent/client/grpc"
 	httpclient "github.com/ulixes-bloom/ya-metrics/internal/agent/client/http"
+	"github.com/ulixes-bloom/ya-metrics/internal/agent/collector"
 	"github.com/ulixes-bloom/ya-metrics/internal/agent/config"
 	"github.com/ulixes-bloom/ya-metrics/internal/agent/memory"
+	"github.com/ulixes-bloom/ya-metrics/internal/agent/push"
+	"github.com/ulixes-bloom/ya-metrics/internal/agent/statsd"
 )
 
 var (
@@ -42,16 +46,62 @@ func main() {
 
 	ms := memory.NewStorage()
 
+	// sources of polled metrics, application-specific collectors are registered here as well
+	registry, err := collector.NewRegistry(
+		collector.NewRuntime(),
+		collector.NewSystem(),
+	)
+	if err != nil {
+		log.Fatal().Msg(err.Error())
+	}
+	if len(conf.Processes) > 0 {
+		processCollector, err := collector.NewProcess(conf.Processes)
+		if err != nil {
+			log.Fatal().Msg(err.Error())
+		}
+		if err := registry.Register(processCollector); err != nil {
+			log.Fatal().Msg(err.Error())
+		}
+	}
+	if urls := conf.GetScrapeURLs(); len(urls) > 0 {
+		if err := registry.Register(collector.NewScrape(urls)); err != nil {
+			log.Fatal().Msg(err.Error())
+		}
+	}
+
+	// applications push custom metrics over StatsD into the same storage
+	var wg sync.WaitGroup
+	if conf.StatsdAddr != "" || conf.StatsdSocket != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := statsd.New(conf, ms).Run(ctx); err != nil {
+				log.Error().Msg(err.Error())
+			}
+		}()
+	}
+
+	// or as the metrics JSON the server accepts over the local push API
+	if conf.PushAddr != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := push.New(conf, ms).Run(ctx); err != nil {
+				log.Error().Msg(err.Error())
+			}
+		}()
+	}
+
 	switch conf.Protocol {
 	case "http":
-		cl, err := httpclient.New(conf, ms)
+		cl, err := httpclient.New(conf, ms, registry)
 		if err != nil {
 			log.Fatal().Msg(err.Error())
 		}
 
 		cl.Run(ctx)
 	case "grpc":
-		cl, err := grpcclient.New(conf, ms)
+		cl, err := grpcclient.New(conf, ms, registry)
 		if err != nil {
 			log.Fatal().Msg(err.Error())
 		}
@@ -60,4 +110,5 @@ func main() {
 	default:
 		log.Fatal().Msgf("unknown client protocol %s", conf.Protocol)
 	}
+	wg.Wait()
 }
@@ -2,19 +2,22 @@ package main
 
 import (
 	"context"
-	"database/sql"
+	"os"
 	"os/signal"
 	"sync"
 	"syscall"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"github.com/ulixes-bloom/ya-metrics/internal/server/alerting"
 	grpcserver "github.com/ulixes-bloom/ya-metrics/internal/server/api/grpc"
 	httpserver "github.com/ulixes-bloom/ya-metrics/internal/server/api/http"
 	"github.com/ulixes-bloom/ya-metrics/internal/server/config"
+	"github.com/ulixes-bloom/ya-metrics/internal/server/notifier"
 	"github.com/ulixes-bloom/ya-metrics/internal/server/service"
 	"github.com/ulixes-bloom/ya-metrics/internal/server/storage/memory"
 	"github.com/ulixes-bloom/ya-metrics/internal/server/storage/pg"
+	"github.com/ulixes-bloom/ya-metrics/internal/server/watcher"
 )
 
 var (
@@ -26,6 +29,16 @@ var (
 func main() {
 	log.Info().Msgf("Build version: %s\nBuild date: %s\nBuild commit: %s\n", buildVersion, buildDate, buildCommit)
 
+	// `server migrate up|down|status [flags]` manages the database schema and exits
+	var migrateCommand string
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if len(os.Args) < 3 {
+			log.Fatal().Msg(migrateUsage)
+		}
+		migrateCommand = os.Args[2]
+		os.Args = append(os.Args[:1], os.Args[3:]...)
+	}
+
 	conf, err := config.Parse()
 	if err != nil {
 		log.Fatal().Err(err).Msg("unable to parse config")
@@ -44,13 +57,20 @@ func main() {
 	}
 	zerolog.SetGlobalLevel(logLvl)
 
+	if migrateCommand != "" {
+		if err := runMigrate(ctx, conf, migrateCommand); err != nil {
+			log.Fatal().Msg(err.Error())
+		}
+		return
+	}
+
 	var storage service.Storage
 	if conf.DatabaseDSN != "" {
-		db, err := sql.Open("pgx", conf.DatabaseDSN)
+		pool, err := pg.NewPool(ctx, conf)
 		if err != nil {
 			log.Fatal().Msg(err.Error())
 		}
-		ps, err := pg.NewStorage(ctx, db)
+		ps, err := pg.NewStorage(ctx, pool, conf)
 		if err != nil {
 			log.Fatal().Msg(err.Error())
 		}
@@ -63,8 +83,21 @@ func main() {
 		storage = ms
 	}
 
+	// notify gRPC watchers about metrics written through any API
+	storage = watcher.New(storage)
+
+	alerts, err := alerting.New(conf, storage, notifier.New(conf))
+	if err != nil {
+		log.Fatal().Msg(err.Error())
+	}
+
 	var wg sync.WaitGroup
-	wg.Add(2)
+	wg.Add(3)
+
+	go func() {
+		defer wg.Done()
+		alerts.Run(ctx)
+	}()
 
 	go func() {
 		defer wg.Done()
@@ -77,7 +110,7 @@ func main() {
 
 	go func() {
 		defer wg.Done()
-		err = httpserver.New(conf, storage).Run(ctx)
+		err = httpserver.New(conf, storage, alerts).Run(ctx)
 		if err != nil {
 			log.Error().Msg(err.Error())
 			ctx.Done()
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/ulixes-bloom/ya-metrics/internal/server/config"
+	"github.com/ulixes-bloom/ya-metrics/internal/server/storage/pg"
+)
+
+const migrateUsage = "usage: server migrate up|down|status [flags]"
+
+// runMigrate runs the migrate subcommand against the database of conf.DatabaseDSN:
+// up applies all pending migrations, down reverts the latest applied one, status lists them.
+func runMigrate(ctx context.Context, conf *config.Config, command string) error {
+	if conf.DatabaseDSN == "" {
+		return errors.New("main.runMigrate: database dsn is not set")
+	}
+	pool, err := pg.NewPool(ctx, conf)
+	if err != nil {
+		return fmt.Errorf("main.runMigrate: %w", err)
+	}
+	defer pool.Close()
+
+	switch command {
+	case "up":
+		err = pg.MigrateUp(ctx, pool)
+	case "down":
+		err = pg.MigrateDown(ctx, pool)
+	case "status":
+		err = printMigrationStatus(ctx, pool)
+	default:
+		return fmt.Errorf("main.runMigrate: unknown command '%s', %s", command, migrateUsage)
+	}
+	if err != nil {
+		return fmt.Errorf("main.runMigrate: %w", err)
+	}
+	return nil
+}
+
+func printMigrationStatus(ctx context.Context, pool *pgxpool.Pool) error {
+	status, err := pg.MigrationStatus(ctx, pool)
+	if err != nil {
+		return fmt.Errorf("main.printMigrationStatus: %w", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, m := range status {
+		appliedAt := "pending"
+		if m.Applied {
+			appliedAt = m.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", m.Version, m.Name, appliedAt)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,69 @@
+// Package clienttest provides the tests shared by the agent clients of different transports.
+package clienttest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ulixes-bloom/ya-metrics/internal/agent/client"
+	"github.com/ulixes-bloom/ya-metrics/internal/agent/memory"
+	"github.com/ulixes-bloom/ya-metrics/internal/agent/service"
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+)
+
+// Receiver is the test server the client reports to.
+type Receiver interface {
+	// SetDown makes the server fail all requests while down is set.
+	SetDown(down bool)
+	// Counter returns the sum of received deltas of the counter.
+	Counter(id string) int64
+}
+
+// NewClientFunc creates the reporter of a client reporting metrics of the storage to a new receiver.
+// If batches is not set, the receiver does not support batch updates and the client falls back to
+// single metric updates.
+type NewClientFunc func(t *testing.T, batches bool, storage service.Storage) (client.Reporter, Receiver)
+
+// RunCounterAck checks counter deltas are kept until the server acknowledges them
+// and are sent exactly once, both with batch and single metric updates.
+func RunCounterAck(t *testing.T, newClient NewClientFunc) {
+	steps := []struct {
+		name    string
+		down    bool
+		delta   int64 // delta of the counter added before the report, if not 0
+		wantErr bool
+		want    int64 // sum of deltas received by the server after the report
+	}{
+		{name: "Delta is kept while the server fails", down: true, delta: 1, wantErr: true},
+		{name: "Deltas are summed while the server fails", down: true, delta: 1, wantErr: true},
+		{name: "Kept deltas are sent once the server is back", want: 2},
+		{name: "New delta is sent", delta: 1, want: 3},
+		{name: "Acknowledged deltas are not sent again", want: 3},
+	}
+
+	for _, batches := range []bool{true, false} {
+		t.Run(fmt.Sprintf("batches=%v", batches), func(t *testing.T) {
+			ctx := context.Background()
+			storage := memory.NewStorage()
+			reporter, rcv := newClient(t, batches, storage)
+
+			for _, step := range steps {
+				rcv.SetDown(step.down)
+				if step.delta != 0 {
+					require.NoError(t, storage.Set(metrics.NewCounterMetric("PollCount", step.delta)))
+				}
+
+				err := reporter.Report(ctx)
+				if step.wantErr {
+					assert.Error(t, err, step.name)
+				} else {
+					assert.NoError(t, err, step.name)
+				}
+				assert.Equal(t, step.want, rcv.Counter("PollCount"), step.name)
+			}
+		})
+	}
+}
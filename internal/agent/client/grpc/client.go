@@ -17,11 +17,13 @@ import (
 	"github.com/ulixes-bloom/ya-metrics/internal/agent/client"
 	"github.com/ulixes-bloom/ya-metrics/internal/agent/config"
 	"github.com/ulixes-bloom/ya-metrics/internal/agent/service"
+	"github.com/ulixes-bloom/ya-metrics/internal/agent/spool"
 	"github.com/ulixes-bloom/ya-metrics/internal/pkg/hash"
 	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
-	"github.com/ulixes-bloom/ya-metrics/internal/pkg/workerpool"
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/protoconv"
 	"github.com/ulixes-bloom/ya-metrics/proto"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/metadata"
@@ -30,14 +32,16 @@ import (
 
 // client handles polling metrics from the system and reporting them to a server.
 type grpcClient struct {
-	service client.Service
-	conn    *grpc.ClientConn
-	conf    *config.Config
-	ip      string
+	service       client.Service
+	reporter      client.Reporter
+	conn          *grpc.ClientConn
+	conf          *config.Config
+	ip            string
+	singleUpdates bool // set once the server turns out not to support streaming updates
 }
 
 // New creates and initializes a new client instance.
-func New(conf *config.Config, storage service.Storage) (*grpcClient, error) {
+func New(conf *config.Config, storage service.Storage, registry service.Registry) (*grpcClient, error) {
 	addrs, err := net.InterfaceAddrs()
 	if err != nil {
 		return nil, fmt.Errorf("grpcclient.new: Error while retrieving interface addresses, %w", err)
@@ -75,17 +79,29 @@ func New(conf *config.Config, storage service.Storage) (*grpcClient, error) {
 		return nil, fmt.Errorf("grpcclient.new: Error while creating grpc connection, %w", err)
 	}
 
-	return &grpcClient{
-		service: service.New(storage),
+	c := grpcClient{
+		service: service.New(conf, storage, registry),
 		conn:    conn,
 		conf:    conf,
 		ip:      ip,
-	}, nil
+	}
+
+	// spool metrics the server fails to receive
+	var sp client.Spool
+	if conf.SpoolPath != "" {
+		sp, err = spool.New(conf.SpoolPath, conf.GetSpoolSizeBytes())
+		if err != nil {
+			return nil, fmt.Errorf("grpcclient.new: %w", err)
+		}
+	}
+	c.reporter = client.NewReporter(c.service, sp, c.send)
+
+	return &c, nil
 }
 
 // Run starts background operations of the client:
 //
-// 1. Polling metrics with the period specified in config.PollInterval.
+// 1. Polling metrics of the registered collectors with the periods specified in config.
 //
 // 2. Reporting metrics to the server with the period specified in config.ReportInterval.
 //
@@ -96,7 +112,7 @@ func (c *grpcClient) Run(ctx context.Context) {
 
 	go func() {
 		defer wg.Done()
-		c.pollMetrics(ctx)
+		c.service.Run(ctx)
 	}()
 
 	go func() {
@@ -107,75 +123,111 @@ func (c *grpcClient) Run(ctx context.Context) {
 	wg.Wait()
 }
 
-// pollMetrics periodically polls system metrics and stores them in memory.
-func (c *grpcClient) pollMetrics(ctx context.Context) {
-	pollTicker := time.NewTicker(c.conf.GetPollIntervalDuration())
-	defer pollTicker.Stop()
-
-	for {
-		select {
-		case <-pollTicker.C:
-			err := c.service.Poll(ctx)
-			if err != nil {
-				log.Error().Msg(err.Error())
-			}
-		case <-ctx.Done():
-			log.Debug().Msg("done polling metrics")
-			return
-		}
-	}
-}
-
-// reportMetrics periodically retrieves all stored metrics from memory and sends them to the server.
-// sending is done in parallel using a workerpool.
+// reportMetrics periodically sends all stored metrics to the server.
 func (c *grpcClient) reportMetrics(ctx context.Context) {
 	reportTicker := time.NewTicker(c.conf.GetReportIntervalDuration())
 	defer reportTicker.Stop()
 
-	// create worker pool for sending metrics to server
-	pool := workerpool.New(c.conf.RateLimit, metrics.MetricsCount, c.sendMetric)
-
 	for {
 		select {
 		case <-reportTicker.C:
-			for _, m := range c.service.GetAll() {
-				pool.Submit(m)
+			if err := c.reporter.Report(ctx); err != nil {
+				log.Error().Msg(err.Error())
 			}
 		case <-ctx.Done():
 			log.Debug().Msg("done reporting metrics")
-			pool.StopAndWait()
 			c.conn.Close()
 			return
 		}
 	}
 }
 
-// sendMetric sends a single metric to the server after compressing and encoding it.
-func (c *grpcClient) sendMetric(m metrics.Metric) error {
-	client := proto.NewMonitoringClient(c.conn)
-	var updateMetricRequest proto.UpdateMetricRequest
-	pbMetric := &proto.Metric{
-		Id:    m.ID,
-		Mtype: m.MType,
-		Value: m.Value,
-		Delta: m.Delta,
+// send sends the metrics in a single stream. If the server does not support streaming,
+// metrics are sent one by one in parallel, limited by config.RateLimit.
+// It returns the metrics that were not sent.
+func (c *grpcClient) send(ctx context.Context, batch []metrics.Metric) ([]metrics.Metric, error) {
+	if !c.singleUpdates {
+		err := c.sendMetrics(ctx, batch)
+		if status.Code(err) != codes.Unimplemented {
+			if err != nil {
+				return batch, err
+			}
+			return nil, nil
+		}
+		log.Warn().Msg("server does not support streaming updates, falling back to single metric updates")
+		c.singleUpdates = true
 	}
-	updateMetricRequest.Metric = pbMetric
+
+	unsent, err := client.SendEach(ctx, batch, c.conf.RateLimit, c.sendMetric)
+	if err != nil {
+		return unsent, fmt.Errorf("grpcclient.send: %w", err)
+	}
+	return nil, nil
+}
+
+// sendMetrics sends metrics to the server in a single client stream, which the server stores as one batch.
+func (c *grpcClient) sendMetrics(ctx context.Context, batch []metrics.Metric) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	client := proto.NewMonitoringClient(c.conn)
 
 	// set agent ip in grpc request metadata
 	md := metadata.New(map[string]string{"x-real-ip": c.ip})
-	ctx := metadata.NewOutgoingContext(context.Background(), md)
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	stream, err := client.UpdateMetrics(ctx)
+	if err != nil {
+		return fmt.Errorf("grpcclient.sendMetrics: %w", err)
+	}
+
+	for _, m := range batch {
+		updateMetricRequest, err := c.newUpdateMetricRequest(m)
+		if err != nil {
+			return fmt.Errorf("grpcclient.sendMetrics: %w", err)
+		}
+		// the actual error is returned by CloseAndRecv
+		if err := stream.Send(updateMetricRequest); err != nil {
+			break
+		}
+	}
+
+	if _, err := stream.CloseAndRecv(); err != nil {
+		return fmt.Errorf("grpcclient.sendMetrics: %w", err)
+	}
+	return nil
+}
+
+// newUpdateMetricRequest creates the request with the metric and its hash.
+func (c *grpcClient) newUpdateMetricRequest(m metrics.Metric) (*proto.UpdateMetricRequest, error) {
+	var updateMetricRequest proto.UpdateMetricRequest
+	pbMetric := protoconv.ToProto(m)
+	updateMetricRequest.Metric = pbMetric
 
 	// calculate and set metric hash in request
 	if c.conf.HashKey != "" {
 		h, err := hash.Encode([]byte(pbMetric.String()), c.conf.HashKey)
 		if err != nil {
-			return fmt.Errorf("grpcclient.sendMetric: %w", err)
+			return nil, fmt.Errorf("grpcclient.newUpdateMetricRequest: %w", err)
 		}
 		updateMetricRequest.Hash = &h
 	}
+	return &updateMetricRequest, nil
+}
+
+// sendMetric sends a single metric to the server after compressing and encoding it.
+func (c *grpcClient) sendMetric(ctx context.Context, m metrics.Metric) error {
+	client := proto.NewMonitoringClient(c.conn)
+	updateMetricRequest, err := c.newUpdateMetricRequest(m)
+	if err != nil {
+		return fmt.Errorf("grpcclient.sendMetric: %w", err)
+	}
+
+	// set agent ip in grpc request metadata
+	md := metadata.New(map[string]string{"x-real-ip": c.ip})
+	ctx = metadata.NewOutgoingContext(ctx, md)
 
-	_, err := client.UpdateMetric(ctx, &updateMetricRequest)
+	_, err = client.UpdateMetric(ctx, updateMetricRequest)
 	if err != nil {
 		if e, ok := status.FromError(err); ok {
 			return fmt.Errorf("grpcclient.sendMetric: %s, %s", e.Message(), e.Code())
@@ -0,0 +1,132 @@
+package grpcclient
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ulixes-bloom/ya-metrics/internal/agent/client"
+	"github.com/ulixes-bloom/ya-metrics/internal/agent/client/clienttest"
+	"github.com/ulixes-bloom/ya-metrics/internal/agent/config"
+	"github.com/ulixes-bloom/ya-metrics/internal/agent/memory"
+	"github.com/ulixes-bloom/ya-metrics/internal/agent/service"
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+	"github.com/ulixes-bloom/ya-metrics/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// receiver is a monitoring server summing received counter deltas.
+type receiver struct {
+	proto.UnimplementedMonitoringServer
+	streams  bool // whether streaming updates are supported
+	down     bool // whether requests fail
+	counters map[string]int64
+	mutex    sync.Mutex
+}
+
+func (r *receiver) UpdateMetric(ctx context.Context, in *proto.UpdateMetricRequest) (*emptypb.Empty, error) {
+	if r.down {
+		return nil, status.Error(codes.Unavailable, "server is down")
+	}
+	r.add(in.GetMetric())
+	return &emptypb.Empty{}, nil
+}
+
+func (r *receiver) UpdateMetrics(stream proto.Monitoring_UpdateMetricsServer) error {
+	if !r.streams {
+		return r.UnimplementedMonitoringServer.UpdateMetrics(stream)
+	}
+
+	var batch []*proto.Metric
+	for {
+		in, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		batch = append(batch, in.GetMetric())
+	}
+	if r.down {
+		return status.Error(codes.Unavailable, "server is down")
+	}
+	for _, m := range batch {
+		r.add(m)
+	}
+	return stream.SendAndClose(&emptypb.Empty{})
+}
+
+func (r *receiver) SetDown(down bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.down = down
+}
+
+func (r *receiver) Counter(id string) int64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.counters[id]
+}
+
+func (r *receiver) add(m *proto.Metric) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if m.GetMtype() == metrics.Counter {
+		r.counters[m.GetId()] += m.GetDelta()
+	}
+}
+
+// newTestClient creates a client connected to the receiver over an in-memory connection.
+func newTestClient(t *testing.T, rcv *receiver, storage service.Storage) *grpcClient {
+	s := grpc.NewServer()
+	proto.RegisterMonitoringServer(s, rcv)
+	listener := bufconn.Listen(1024 * 1024)
+	go s.Serve(listener)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	conf := config.GetDefault()
+	c := &grpcClient{
+		service: service.New(conf, storage, nil),
+		conn:    conn,
+		conf:    conf,
+	}
+	c.reporter = client.NewReporter(c.service, nil, c.send)
+	return c
+}
+
+func TestCounterAck(t *testing.T) {
+	clienttest.RunCounterAck(t, func(t *testing.T, batches bool, storage service.Storage) (client.Reporter, clienttest.Receiver) {
+		rcv := &receiver{streams: batches, counters: map[string]int64{}}
+		c := newTestClient(t, rcv, storage)
+		return c.reporter, rcv
+	})
+}
+
+func TestStreamFallback(t *testing.T) {
+	for _, streams := range []bool{true, false} {
+		rcv := &receiver{streams: streams, counters: map[string]int64{}}
+		storage := memory.NewStorage()
+		c := newTestClient(t, rcv, storage)
+
+		require.NoError(t, storage.Set(metrics.NewCounterMetric("PollCount", 1)))
+		require.NoError(t, c.reporter.Report(context.Background()))
+		assert.Equal(t, int64(1), rcv.Counter("PollCount"))
+		assert.Equal(t, !streams, c.singleUpdates)
+	}
+}
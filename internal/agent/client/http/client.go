@@ -8,6 +8,7 @@ import (
 	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
@@ -19,22 +20,28 @@ import (
 	"github.com/ulixes-bloom/ya-metrics/internal/agent/client"
 	"github.com/ulixes-bloom/ya-metrics/internal/agent/config"
 	"github.com/ulixes-bloom/ya-metrics/internal/agent/service"
+	"github.com/ulixes-bloom/ya-metrics/internal/agent/spool"
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/hash"
 	"github.com/ulixes-bloom/ya-metrics/internal/pkg/headers"
 	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
 	"github.com/ulixes-bloom/ya-metrics/internal/pkg/rsa"
-	"github.com/ulixes-bloom/ya-metrics/internal/pkg/workerpool"
 )
 
+// errNotFound is returned when the server does not have the requested endpoint.
+var errNotFound = errors.New("endpoint not found")
+
 // httpClient handles polling metrics from the system and reporting them to a server.
 type httpClient struct {
-	service client.Service
-	http    *http.Client
-	conf    *config.Config
-	ip      string
+	service       client.Service
+	reporter      client.Reporter
+	http          *http.Client
+	conf          *config.Config
+	ip            string
+	singleUpdates bool // set once the server turns out not to support batch updates
 }
 
 // New creates and initializes a new client instance.
-func New(conf *config.Config, storage service.Storage) (*httpClient, error) {
+func New(conf *config.Config, storage service.Storage, registry service.Registry) (*httpClient, error) {
 	addrs, err := net.InterfaceAddrs()
 	if err != nil {
 		return nil, fmt.Errorf("client.new: Error while retrieving interface addresses, %w", err)
@@ -48,17 +55,29 @@ func New(conf *config.Config, storage service.Storage) (*httpClient, error) {
 		}
 	}
 
-	return &httpClient{
-		service: service.New(storage),
+	c := httpClient{
+		service: service.New(conf, storage, registry),
 		http:    &http.Client{},
 		conf:    conf,
 		ip:      ip,
-	}, nil
+	}
+
+	// spool metrics the server fails to receive
+	var sp client.Spool
+	if conf.SpoolPath != "" {
+		sp, err = spool.New(conf.SpoolPath, conf.GetSpoolSizeBytes())
+		if err != nil {
+			return nil, fmt.Errorf("client.new: %w", err)
+		}
+	}
+	c.reporter = client.NewReporter(c.service, sp, c.send)
+
+	return &c, nil
 }
 
 // Run starts background operations of the client:
 //
-// 1. Polling metrics with the period specified in config.PollInterval.
+// 1. Polling metrics of the registered collectors with the periods specified in config.
 //
 // 2. Reporting metrics to the server with the period specified in config.ReportInterval.
 //
@@ -69,7 +88,7 @@ func (c *httpClient) Run(ctx context.Context) {
 
 	go func() {
 		defer wg.Done()
-		c.pollMetrics(ctx)
+		c.service.Run(ctx)
 	}()
 
 	go func() {
@@ -80,60 +99,76 @@ func (c *httpClient) Run(ctx context.Context) {
 	wg.Wait()
 }
 
-// pollMetrics periodically polls system metrics and stores them in memory.
-func (c *httpClient) pollMetrics(ctx context.Context) {
-	pollTicker := time.NewTicker(c.conf.GetPollIntervalDuration())
-	defer pollTicker.Stop()
+// reportMetrics periodically sends all stored metrics to the server.
+func (c *httpClient) reportMetrics(ctx context.Context) {
+	reportTicker := time.NewTicker(c.conf.GetReportIntervalDuration())
+	defer reportTicker.Stop()
 
 	for {
 		select {
-		case <-pollTicker.C:
-			err := c.service.Poll(ctx)
-			if err != nil {
+		case <-reportTicker.C:
+			if err := c.reporter.Report(ctx); err != nil {
 				log.Error().Msg(err.Error())
 			}
 		case <-ctx.Done():
-			log.Debug().Msg("done polling metrics")
+			log.Debug().Msg("done reporting metrics")
 			return
 		}
 	}
 }
 
-// reportMetrics periodically retrieves all stored metrics from memory and sends them to the server.
-// sending is done in parallel using a workerpool.
-func (c *httpClient) reportMetrics(ctx context.Context) {
-	reportTicker := time.NewTicker(c.conf.GetReportIntervalDuration())
-	defer reportTicker.Stop()
+// send sends the metrics in batches of config.BatchSize metrics. If the server does not support batches,
+// metrics are sent one by one in parallel, limited by config.RateLimit.
+// It returns the metrics that were not sent.
+func (c *httpClient) send(ctx context.Context, batch []metrics.Metric) ([]metrics.Metric, error) {
+	if !c.singleUpdates {
+		unsent, err := c.sendMetrics(ctx, batch)
+		if !errors.Is(err, errNotFound) {
+			return unsent, err
+		}
+		log.Warn().Msg("server does not support batch updates, falling back to single metric updates")
+		c.singleUpdates = true
+	}
 
-	// create worker pool for sending metrics to server
-	pool := workerpool.New(c.conf.RateLimit, metrics.MetricsCount, c.sendMetric)
+	unsent, err := client.SendEach(ctx, batch, c.conf.RateLimit, c.sendMetric)
+	if err != nil {
+		return unsent, fmt.Errorf("client.send: %w", err)
+	}
+	return nil, nil
+}
 
-	for {
-		select {
-		case <-reportTicker.C:
-			for _, m := range c.service.GetAll() {
-				pool.Submit(m)
-			}
-		case <-ctx.Done():
-			log.Debug().Msg("done reporting metrics")
-			pool.StopAndWait()
-			return
+// sendMetrics sends metrics to the server in batches of config.BatchSize metrics.
+// It stops at the first batch that fails and returns it with the rest of the metrics.
+func (c *httpClient) sendMetrics(ctx context.Context, batch []metrics.Metric) ([]metrics.Metric, error) {
+	for start := 0; start < len(batch); start += c.conf.BatchSize {
+		end := min(start+c.conf.BatchSize, len(batch))
+		if err := c.post(ctx, "/updates/", batch[start:end]); err != nil {
+			return batch[start:], fmt.Errorf("client.sendMetrics: %w", err)
 		}
 	}
+	return nil, nil
 }
 
-// sendMetric sends a single metric to the server after compressing and encoding it.
-func (c *httpClient) sendMetric(m metrics.Metric) error {
-	// Marshal metric to JSON
-	marshalled, err := json.Marshal(m)
-	if err != nil {
+// sendMetric sends a single metric to the server.
+func (c *httpClient) sendMetric(ctx context.Context, m metrics.Metric) error {
+	if err := c.post(ctx, "/update/", m); err != nil {
 		return fmt.Errorf("client.sendMetric: %w", err)
 	}
+	return nil
+}
+
+// post sends the value to the server path after encoding, encrypting, compressing and signing it.
+func (c *httpClient) post(ctx context.Context, path string, value any) error {
+	// Marshal value to JSON
+	marshalled, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("client.post: %w", err)
+	}
 
 	if c.conf.CryptoKey != "" {
 		marshalled, err = rsa.Encrypt(marshalled, c.conf.CryptoKey)
 		if err != nil {
-			return fmt.Errorf("client.sendMetric: %w", err)
+			return fmt.Errorf("client.post: %w", err)
 		}
 	}
 
@@ -142,16 +177,25 @@ func (c *httpClient) sendMetric(m metrics.Metric) error {
 	gb := gzip.NewWriter(&buf)
 	_, err = gb.Write(marshalled)
 	if err != nil {
-		return fmt.Errorf("client.sendMetric: failed to compress metric, %w", err)
+		return fmt.Errorf("client.post: failed to compress metrics, %w", err)
 	}
 	err = gb.Close()
 	if err != nil {
-		return fmt.Errorf("client.sendMetric: failed to close gzip writer, %w", err)
+		return fmt.Errorf("client.post: failed to close gzip writer, %w", err)
+	}
+
+	// Sign the request body as it is sent over the wire
+	var bodyHash string
+	if c.conf.HashKey != "" {
+		bodyHash, err = hash.Encode(buf.Bytes(), c.conf.HashKey)
+		if err != nil {
+			return fmt.Errorf("client.post: %w", err)
+		}
 	}
 
 	// Construct the request
-	url := fmt.Sprintf("%s/update/", c.conf.GetNormilizedServerAddr())
-	req, err := http.NewRequest(http.MethodPost, url, &buf)
+	url := c.conf.GetNormilizedServerAddr() + path
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, &buf)
 	if err != nil {
 		return err
 	}
@@ -159,17 +203,23 @@ func (c *httpClient) sendMetric(m metrics.Metric) error {
 	req.Header.Add(headers.AcceptEncoding, "gzip")
 	req.Header.Add(headers.ContentEncoding, "gzip")
 	req.Header.Add(headers.XRealIP, c.ip)
+	if bodyHash != "" {
+		req.Header.Add(headers.HashSHA256, bodyHash)
+	}
 
 	// Execute the HTTP request
 	res, err := c.http.Do(req)
 	if err != nil {
-		return fmt.Errorf("client.sendMetric: %w", err)
+		return fmt.Errorf("client.post: %w", err)
 	}
 	defer res.Body.Close() // Ensure the body is always closed
 
 	// Validate the response status code
+	if res.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("client.post: '%s', %w", path, errNotFound)
+	}
 	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("client.sendMetric: unexpected response status code while sending metrics '%s'", res.Status)
+		return fmt.Errorf("client.post: unexpected response status code while sending metrics '%s'", res.Status)
 	}
 
 	return nil
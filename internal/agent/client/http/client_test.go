@@ -0,0 +1,225 @@
+package httpclient
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ulixes-bloom/ya-metrics/internal/agent/client"
+	"github.com/ulixes-bloom/ya-metrics/internal/agent/client/clienttest"
+	"github.com/ulixes-bloom/ya-metrics/internal/agent/config"
+	"github.com/ulixes-bloom/ya-metrics/internal/agent/service"
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/hash"
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/headers"
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/rsa"
+)
+
+type staticService struct {
+	metrics map[string]metrics.Metric
+}
+
+func (s *staticService) GetAll() map[string]metrics.Metric {
+	return s.metrics
+}
+
+func (s *staticService) Ack(batch []metrics.Metric) {}
+
+func (s *staticService) Run(ctx context.Context) {}
+
+// receiver checks and decodes requests of the agent, counting received metrics by path.
+type receiver struct {
+	hashKey    string
+	privateKey string
+	batches    bool // whether /updates/ is supported
+	down       bool // whether requests fail with a server error
+	received   map[string]int
+	requests   map[string]int
+	counters   map[string]int64 // sums of received counter deltas
+	mutex      sync.Mutex
+}
+
+func (r *receiver) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	if r.down {
+		http.Error(res, "server is down", http.StatusInternalServerError)
+		return
+	}
+	if req.URL.Path == "/updates/" && !r.batches {
+		http.NotFound(res, req)
+		return
+	}
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if r.hashKey != "" {
+		h, _ := hash.Encode(body, r.hashKey)
+		if h != req.Header.Get(headers.HashSHA256) {
+			http.Error(res, "incorrect hash", http.StatusBadRequest)
+			return
+		}
+	}
+
+	gr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	data, err := io.ReadAll(gr)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if r.privateKey != "" {
+		if data, err = rsa.Decrypt(data, r.privateKey); err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var batch []metrics.Metric
+	if req.URL.Path == "/updates/" {
+		err = json.Unmarshal(data, &batch)
+	} else {
+		batch = make([]metrics.Metric, 1)
+		err = json.Unmarshal(data, &batch[0])
+	}
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.requests[req.URL.Path]++
+	r.received[req.URL.Path] += len(batch)
+	for _, m := range batch {
+		if m.MType == metrics.Counter {
+			r.counters[m.ID] += m.GetDelta()
+		}
+	}
+}
+
+func (r *receiver) SetDown(down bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.down = down
+}
+
+func (r *receiver) Counter(id string) int64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.counters[id]
+}
+
+func newReceiver(batches bool) *receiver {
+	return &receiver{
+		batches:  batches,
+		received: map[string]int{},
+		requests: map[string]int{},
+		counters: map[string]int64{},
+	}
+}
+
+func TestReport(t *testing.T) {
+	dir := t.TempDir()
+	publicKeyPEM, privateKeyPEM, err := rsa.GenerateKeyPair()
+	require.NoError(t, err)
+	publicKey := filepath.Join(dir, "public.pem")
+	privateKey := filepath.Join(dir, "private.pem")
+	require.NoError(t, os.WriteFile(publicKey, publicKeyPEM, 0600))
+	require.NoError(t, os.WriteFile(privateKey, privateKeyPEM, 0600))
+
+	allMetrics := map[string]metrics.Metric{}
+	for i := range 5 {
+		m := metrics.NewGaugeMetric(fmt.Sprintf("Gauge%d", i), float64(i))
+		allMetrics[m.ID] = m
+	}
+
+	tests := []struct {
+		name         string
+		batches      bool
+		cryptoKey    bool
+		wantRequests map[string]int
+	}{
+		{
+			name:         "Metrics are sent in batches",
+			batches:      true,
+			wantRequests: map[string]int{"/updates/": 3},
+		},
+		{
+			name:         "Encrypted metrics are sent in batches",
+			batches:      true,
+			cryptoKey:    true,
+			wantRequests: map[string]int{"/updates/": 3},
+		},
+		{
+			name:         "Metrics are sent one by one if batches are not supported",
+			wantRequests: map[string]int{"/update/": 5},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rcv := newReceiver(test.batches)
+			rcv.hashKey = "secret"
+			conf := config.GetDefault()
+			conf.HashKey = rcv.hashKey
+			conf.BatchSize = 2
+			if test.cryptoKey {
+				conf.CryptoKey = publicKey
+				rcv.privateKey = privateKey
+			}
+
+			ts := httptest.NewServer(rcv)
+			defer ts.Close()
+			conf.ServerAddr = strings.TrimPrefix(ts.URL, "http://")
+
+			c := &httpClient{
+				service: &staticService{metrics: allMetrics},
+				http:    ts.Client(),
+				conf:    conf,
+			}
+			c.reporter = client.NewReporter(c.service, nil, c.send)
+			require.NoError(t, c.reporter.Report(context.Background()))
+
+			assert.Equal(t, test.wantRequests, rcv.requests)
+			for path := range test.wantRequests {
+				assert.Equal(t, len(allMetrics), rcv.received[path])
+			}
+			assert.Equal(t, !test.batches, c.singleUpdates)
+		})
+	}
+}
+
+func TestCounterAck(t *testing.T) {
+	clienttest.RunCounterAck(t, func(t *testing.T, batches bool, storage service.Storage) (client.Reporter, clienttest.Receiver) {
+		rcv := newReceiver(batches)
+		ts := httptest.NewServer(rcv)
+		t.Cleanup(ts.Close)
+
+		conf := config.GetDefault()
+		conf.ServerAddr = strings.TrimPrefix(ts.URL, "http://")
+		c := &httpClient{
+			service: service.New(conf, storage, nil),
+			http:    ts.Client(),
+			conf:    conf,
+		}
+		c.reporter = client.NewReporter(c.service, nil, c.send)
+		return c.reporter, rcv
+	})
+}
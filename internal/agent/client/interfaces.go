@@ -8,5 +8,17 @@ import (
 
 type Service interface {
 	GetAll() map[string]metrics.Metric
-	Poll(context.Context) error
+	Ack(batch []metrics.Metric)
+	Run(ctx context.Context)
+}
+
+type Reporter interface {
+	Report(ctx context.Context) error
+}
+
+type Spool interface {
+	Push(batch []metrics.Metric) error
+	Peek() (id string, batch []metrics.Metric, err error)
+	Replace(id string, batch []metrics.Metric) error
+	Remove(id string) error
 }
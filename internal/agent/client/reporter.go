@@ -0,0 +1,126 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+)
+
+// SendFunc sends the batch of metrics to the server and returns metrics that were not sent.
+type SendFunc func(ctx context.Context, batch []metrics.Metric) (unsent []metrics.Metric, err error)
+
+// reporter sends metrics to the server, spooling the ones that could not be sent.
+//
+// Counter deltas, histogram and summary observations are acknowledged in the service,
+// i.e. removed from the pending values, only once the server accepted them or they were spooled.
+// Metrics that neither reached the server nor the spool stay pending and are sent with the next report.
+type reporter struct {
+	service Service
+	spool   Spool // optional
+	send    SendFunc
+}
+
+// NewReporter creates a reporter sending metrics of the service with the send function.
+// The spool may be nil, then unsent metrics are only kept in the service.
+func NewReporter(service Service, spool Spool, send SendFunc) *reporter {
+	return &reporter{
+		service: service,
+		spool:   spool,
+		send:    send,
+	}
+}
+
+// Report replays spooled batches from the oldest to the newest and then sends the current metrics.
+// While spooled batches can't be replayed, current metrics are spooled to preserve the order of updates.
+func (r *reporter) Report(ctx context.Context) error {
+	replayed, replayErr := r.replay(ctx)
+
+	snapshot := r.snapshot()
+	if len(snapshot) == 0 {
+		return replayErr
+	}
+
+	unsent := snapshot
+	var sendErr error
+	if replayed {
+		unsent, sendErr = r.send(ctx, snapshot)
+		r.service.Ack(sentMetrics(snapshot, unsent))
+	}
+
+	var spoolErr error
+	if len(unsent) > 0 && r.spool != nil {
+		if spoolErr = r.spool.Push(unsent); spoolErr == nil {
+			r.service.Ack(unsent)
+		}
+	}
+
+	if err := errors.Join(replayErr, sendErr, spoolErr); err != nil {
+		return fmt.Errorf("client.report: %w", err)
+	}
+	return nil
+}
+
+// replay sends spooled batches in order until the spool is empty or a batch fails to be sent.
+// It reports whether the spool has been emptied.
+func (r *reporter) replay(ctx context.Context) (bool, error) {
+	if r.spool == nil {
+		return true, nil
+	}
+
+	for {
+		id, batch, err := r.spool.Peek()
+		if err != nil {
+			return false, fmt.Errorf("client.replay: %w", err)
+		}
+		if id == "" {
+			return true, nil
+		}
+
+		unsent, err := r.send(ctx, batch)
+		if err != nil {
+			// keep the rest of the batch at the head of the queue
+			if len(unsent) < len(batch) {
+				if replaceErr := r.spool.Replace(id, unsent); replaceErr != nil {
+					err = errors.Join(err, replaceErr)
+				}
+			}
+			return false, fmt.Errorf("client.replay: %w", err)
+		}
+		if err := r.spool.Remove(id); err != nil {
+			return false, fmt.Errorf("client.replay: %w", err)
+		}
+	}
+}
+
+// snapshot returns the current metrics of the service ordered by series key.
+func (r *reporter) snapshot() []metrics.Metric {
+	all := r.service.GetAll()
+	res := make([]metrics.Metric, 0, len(all))
+	for _, m := range all {
+		res = append(res, m)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Key() < res[j].Key() })
+	return res
+}
+
+// sentMetrics returns metrics of the batch that are not in unsent.
+func sentMetrics(batch, unsent []metrics.Metric) []metrics.Metric {
+	if len(unsent) == 0 {
+		return batch
+	}
+
+	unsentKeys := make(map[string]bool, len(unsent))
+	for _, m := range unsent {
+		unsentKeys[m.Key()] = true
+	}
+	res := make([]metrics.Metric, 0, len(batch)-len(unsent))
+	for _, m := range batch {
+		if !unsentKeys[m.Key()] {
+			res = append(res, m)
+		}
+	}
+	return res
+}
@@ -0,0 +1,82 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ulixes-bloom/ya-metrics/internal/agent/client"
+	"github.com/ulixes-bloom/ya-metrics/internal/agent/config"
+	"github.com/ulixes-bloom/ya-metrics/internal/agent/memory"
+	"github.com/ulixes-bloom/ya-metrics/internal/agent/service"
+	"github.com/ulixes-bloom/ya-metrics/internal/agent/spool"
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+)
+
+// server imitates the server side, summing received counter deltas.
+type server struct {
+	down     bool
+	received [][]metrics.Metric
+	counters map[string]int64
+}
+
+func (s *server) send(ctx context.Context, batch []metrics.Metric) ([]metrics.Metric, error) {
+	if s.down {
+		return batch, errors.New("server is down")
+	}
+	s.received = append(s.received, batch)
+	for _, m := range batch {
+		if m.MType == metrics.Counter {
+			s.counters[m.ID] += m.GetDelta()
+		}
+	}
+	return nil, nil
+}
+
+func TestReport(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		withSpool bool
+		wantSends int // number of batches received once the server is up
+	}{
+		{name: "Unsent metrics are spooled and replayed in order", withSpool: true, wantSends: 3},
+		{name: "Unsent metrics are kept in memory without spool", withSpool: false, wantSends: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			storage := memory.NewStorage()
+			srv := &server{down: true, counters: map[string]int64{}}
+
+			var sp client.Spool
+			if test.withSpool {
+				s, err := spool.New(t.TempDir(), 1<<20)
+				require.NoError(t, err)
+				sp = s
+			}
+			r := client.NewReporter(service.New(config.GetDefault(), storage, nil), sp, srv.send)
+
+			require.NoError(t, storage.SetAll([]metrics.Metric{
+				metrics.NewCounterMetric("PollCount", 3),
+				metrics.NewGaugeMetric("Alloc", 1),
+			}))
+			assert.Error(t, r.Report(ctx))
+
+			require.NoError(t, storage.Set(metrics.NewCounterMetric("PollCount", 2)))
+			assert.Error(t, r.Report(ctx))
+
+			srv.down = false
+			require.NoError(t, r.Report(ctx))
+			assert.Len(t, srv.received, test.wantSends)
+			assert.Equal(t, int64(5), srv.counters["PollCount"])
+
+			// everything is acknowledged, nothing is sent twice
+			require.NoError(t, r.Report(ctx))
+			assert.Equal(t, int64(5), srv.counters["PollCount"])
+		})
+	}
+}
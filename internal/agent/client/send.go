@@ -0,0 +1,41 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+	"golang.org/x/sync/errgroup"
+)
+
+// SendMetricFunc sends a single metric to the server.
+type SendMetricFunc func(ctx context.Context, m metrics.Metric) error
+
+// SendEach sends the metrics one by one in parallel, at most limit at a time,
+// for servers that do not support batch updates. It returns the metrics that were not sent.
+func SendEach(ctx context.Context, batch []metrics.Metric, limit int, send SendMetricFunc) ([]metrics.Metric, error) {
+	var unsent []metrics.Metric
+	var errs []error
+	var mutex sync.Mutex
+	g := errgroup.Group{}
+	g.SetLimit(limit)
+	for _, m := range batch {
+		g.Go(func() error {
+			if err := send(ctx, m); err != nil {
+				mutex.Lock()
+				defer mutex.Unlock()
+				unsent = append(unsent, m)
+				errs = append(errs, err)
+			}
+			return nil
+		})
+	}
+	g.Wait()
+
+	if len(errs) > 0 {
+		return unsent, fmt.Errorf("client.sendEach: %w", errors.Join(errs...))
+	}
+	return nil, nil
+}
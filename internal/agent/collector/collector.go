@@ -0,0 +1,63 @@
+// Package collector provides sources of metrics polled by the agent.
+//
+// Every source implements the Collector interface and is added to a Registry,
+// which the agent service polls, each collector with its own interval.
+package collector
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+)
+
+// Collector is a source of metrics polled by the agent.
+type Collector interface {
+	// Name identifies the collector in the configuration and logs.
+	Name() string
+	// Collect returns the current values of the metrics. On a partial failure it may return
+	// the metrics it managed to collect along with the error.
+	Collect(ctx context.Context) ([]metrics.Metric, error)
+}
+
+// registry keeps collectors in the order they were registered.
+type registry struct {
+	collectors []Collector
+	names      map[string]bool
+	mutex      sync.RWMutex
+}
+
+// NewRegistry creates a registry with the given collectors.
+func NewRegistry(collectors ...Collector) (*registry, error) {
+	r := registry{names: map[string]bool{}}
+	for _, c := range collectors {
+		if err := r.Register(c); err != nil {
+			return nil, fmt.Errorf("collector.newRegistry: %w", err)
+		}
+	}
+	return &r, nil
+}
+
+// Register adds the collector to the registry. Names of collectors must be unique.
+func (r *registry) Register(c Collector) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.names[c.Name()] {
+		return fmt.Errorf("collector.register: duplicate collector name '%s'", c.Name())
+	}
+	r.names[c.Name()] = true
+	r.collectors = append(r.collectors, c)
+	return nil
+}
+
+// Collectors returns the registered collectors.
+func (r *registry) Collectors() []Collector {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	res := make([]Collector, len(r.collectors))
+	copy(res, r.collectors)
+	return res
+}
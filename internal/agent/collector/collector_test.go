@@ -0,0 +1,187 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ulixes-bloom/ya-metrics/internal/agent/config"
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+)
+
+func TestRegistry(t *testing.T) {
+	r, err := NewRegistry(NewRuntime(), NewSystem())
+	require.NoError(t, err)
+	assert.Error(t, r.Register(NewRuntime()), "collector names must be unique")
+
+	var names []string
+	for _, c := range r.Collectors() {
+		names = append(names, c.Name())
+	}
+	assert.Equal(t, []string{RuntimeName, SystemName}, names)
+}
+
+func TestRuntime(t *testing.T) {
+	values, err := NewRuntime().Collect(context.Background())
+	require.NoError(t, err)
+
+	byID := map[string]metrics.Metric{}
+	for _, m := range values {
+		byID[m.ID] = m
+	}
+	require.Contains(t, byID, "PollCount")
+	pollCount := byID["PollCount"]
+	assert.Equal(t, int64(1), pollCount.GetDelta())
+	assert.Equal(t, metrics.Gauge, byID["HeapAlloc"].MType)
+}
+
+func TestSystem(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("host metrics are checked on linux only")
+	}
+	ctx := context.Background()
+	c := NewSystem()
+
+	first, err := c.Collect(ctx)
+	require.NoError(t, err)
+	second, err := c.Collect(ctx)
+	require.NoError(t, err)
+
+	byKey := func(values []metrics.Metric) map[string]metrics.Metric {
+		res := map[string]metrics.Metric{}
+		for _, m := range values {
+			res[m.Key()] = m
+		}
+		return res
+	}
+	firstByKey, secondByKey := byKey(first), byKey(second)
+
+	for _, id := range []string{"TotalMemory", "FreeMemory", "SwapTotal", "CPUutilization1", "LoadAverage1", "LoadAverage15"} {
+		assert.Contains(t, firstByKey, id)
+	}
+	var mountpoints []string
+	for _, m := range first {
+		if m.ID == "DiskUsedBytes" {
+			mountpoints = append(mountpoints, m.Labels["mountpoint"])
+		}
+	}
+	assert.NotEmpty(t, mountpoints)
+	assert.Empty(t, firstByKey["CPUutilization1"].Labels)
+	assert.Contains(t, firstByKey, metrics.SeriesKey("CPUCoreUtilization", map[string]string{"cpu": "0"}))
+
+	// cumulative network statistics are reported as increases starting with the second collection
+	lo := metrics.SeriesKey("NetBytesRecv", map[string]string{"interface": "lo"})
+	assert.NotContains(t, firstByKey, lo)
+	require.Contains(t, secondByKey, lo)
+	bytesRecv := secondByKey[lo]
+	assert.Equal(t, metrics.Counter, bytesRecv.MType)
+	assert.GreaterOrEqual(t, bytesRecv.GetDelta(), int64(0))
+}
+
+func TestProcess(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("process metrics are checked on linux only")
+	}
+	pid := strconv.Itoa(os.Getpid())
+	pidFile := filepath.Join(t.TempDir(), "test.pid")
+	require.NoError(t, os.WriteFile(pidFile, []byte(pid+"\n"), 0644))
+	exe, err := os.Executable()
+	require.NoError(t, err)
+
+	c, err := NewProcess([]config.ProcessConfig{
+		{Name: "by-pid-file", PIDFile: pidFile},
+		{Name: "by-exe", Exe: filepath.Base(exe)},
+		{Name: "by-cmdline", Cmdline: regexp.QuoteMeta(filepath.Base(exe))},
+		{Name: "missing", Exe: "no-such-process"},
+	})
+	require.NoError(t, err)
+
+	values, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	byKey := map[string]metrics.Metric{}
+	for _, m := range values {
+		byKey[m.Key()] = m
+	}
+
+	missing := map[string]string{"process": "missing"}
+	for _, id := range []string{"ProcessCount", "ProcessRSS", "ProcessUptime"} {
+		require.Contains(t, byKey, metrics.SeriesKey(id, missing))
+		m := byKey[metrics.SeriesKey(id, missing)]
+		assert.Equal(t, float64(0), m.GetValue(), id)
+	}
+	for _, name := range []string{"by-pid-file", "by-exe", "by-cmdline"} {
+		labels := map[string]string{"process": name}
+		count := byKey[metrics.SeriesKey("ProcessCount", labels)]
+		assert.GreaterOrEqual(t, count.GetValue(), float64(1), name)
+		require.Contains(t, byKey, metrics.SeriesKey("ProcessRSS", labels), name)
+		rss := byKey[metrics.SeriesKey("ProcessRSS", labels)]
+		threads := byKey[metrics.SeriesKey("ProcessThreads", labels)]
+		fds := byKey[metrics.SeriesKey("ProcessOpenFDs", labels)]
+		assert.Greater(t, rss.GetValue(), float64(0))
+		assert.Greater(t, threads.GetValue(), float64(0))
+		assert.Greater(t, fds.GetValue(), float64(0))
+		assert.Contains(t, byKey, metrics.SeriesKey("ProcessUptime", labels))
+		assert.Contains(t, byKey, metrics.SeriesKey("ProcessCPUPercent", labels))
+	}
+}
+
+func TestScrape(t *testing.T) {
+	requests := 0.0
+	ts := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		fmt.Fprintf(res, "# TYPE http_requests_total counter\n"+
+			"http_requests_total{code=\"200\"} %g\n"+
+			"# TYPE queue_size gauge\n"+
+			"queue_size 4\n"+
+			"# TYPE latency histogram\n"+
+			"latency_bucket{le=\"1\"} 2\n"+
+			"latency_bucket{le=\"+Inf\"} 3\n", requests)
+	}))
+	defer ts.Close()
+	u, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	c := NewScrape([]string{ts.URL + "/metrics", "http://127.0.0.1:1/metrics"})
+	collect := func() map[string]metrics.Metric {
+		values, err := c.Collect(ctx)
+		assert.Error(t, err, "unreachable endpoint is reported")
+		res := map[string]metrics.Metric{}
+		for _, m := range values {
+			res[m.Key()] = m
+		}
+		return res
+	}
+
+	requestsKey := metrics.SeriesKey("http_requests_total", map[string]string{"instance": u.Host, "code": "200"})
+	requests = 10.5
+	first := collect()
+	assert.NotContains(t, first, requestsKey, "counter increase is known starting with the second scrape")
+	queueSize := first[metrics.SeriesKey("queue_size", map[string]string{"instance": u.Host})]
+	assert.Equal(t, float64(4), queueSize.GetValue())
+	bucket := first[metrics.SeriesKey("latency_bucket", map[string]string{"instance": u.Host, "le": "+Inf"})]
+	assert.Equal(t, metrics.Gauge, bucket.MType)
+	assert.Equal(t, float64(3), bucket.GetValue())
+
+	requests = 13.2
+	second := collect()
+	require.Contains(t, second, requestsKey)
+	counter := second[requestsKey]
+	assert.Equal(t, metrics.Counter, counter.MType)
+	assert.Equal(t, int64(3), counter.GetDelta())
+
+	// the counter is reset by a restart of the service
+	requests = 2
+	third := collect()
+	counter = third[requestsKey]
+	assert.Equal(t, int64(2), counter.GetDelta())
+}
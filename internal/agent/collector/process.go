@@ -0,0 +1,205 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+	"github.com/ulixes-bloom/ya-metrics/internal/agent/config"
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+)
+
+// ProcessName is the name of the watched processes collector.
+const ProcessName = "process"
+
+// watch selects processes by exactly one of the PID file, executable name and command line.
+type watch struct {
+	name    string
+	pidFile string
+	exe     string
+	cmdline *regexp.Regexp
+}
+
+// processCollector collects resource usage of the watched processes.
+// Metrics are labelled by the watch name in the "process" label and sum up the usage of all
+// processes matching the watch, so restarted processes keep reporting to the same series.
+type processCollector struct {
+	watches []watch
+	procs   map[int32]*process.Process // processes of the previous collection, keeping CPU times between collections
+}
+
+// NewProcess creates the collector of the processes selected by the config.
+func NewProcess(processes []config.ProcessConfig) (*processCollector, error) {
+	c := processCollector{procs: map[int32]*process.Process{}}
+	for _, p := range processes {
+		w := watch{
+			name:    p.Name,
+			pidFile: p.PIDFile,
+			exe:     p.Exe,
+		}
+		if p.Cmdline != "" {
+			re, err := regexp.Compile(p.Cmdline)
+			if err != nil {
+				return nil, fmt.Errorf("collector.newProcess: %w", err)
+			}
+			w.cmdline = re
+		}
+		c.watches = append(c.watches, w)
+	}
+	return &c, nil
+}
+
+func (c *processCollector) Name() string {
+	return ProcessName
+}
+
+// Collect returns the number of processes matching every watch and their total RSS, CPU percentage,
+// open file descriptors and threads along with the uptime of the longest running one.
+// All values of a watch without matching processes are zero. CPU percentage of a process
+// is zero on its first collection.
+func (c *processCollector) Collect(ctx context.Context) ([]metrics.Metric, error) {
+	var all []*process.Process
+	for _, w := range c.watches {
+		if w.pidFile == "" {
+			var err error
+			if all, err = process.ProcessesWithContext(ctx); err != nil {
+				return nil, fmt.Errorf("collector.process: %w", err)
+			}
+			break
+		}
+	}
+
+	var res []metrics.Metric
+	var errs []error
+	procs := map[int32]*process.Process{}
+	for _, w := range c.watches {
+		pids, err := c.match(ctx, w, all)
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		var total usage
+		count := 0
+		for _, pid := range pids {
+			p, ok := procs[pid]
+			if !ok {
+				if p, ok = c.procs[pid]; !ok {
+					if p, err = process.NewProcessWithContext(ctx, pid); err != nil {
+						// the process has exited
+						continue
+					}
+				}
+				procs[pid] = p
+			}
+
+			u, err := collectProcess(ctx, p)
+			if err != nil {
+				if running, _ := p.IsRunningWithContext(ctx); running {
+					errs = append(errs, err)
+				}
+				continue
+			}
+			total.rss += u.rss
+			total.cpuPercent += u.cpuPercent
+			total.fds += u.fds
+			total.threads += u.threads
+			total.uptime = max(total.uptime, u.uptime)
+			count++
+		}
+
+		labels := map[string]string{"process": w.name}
+		res = append(res,
+			withLabels(metrics.NewGaugeMetric("ProcessCount", float64(count)), labels),
+			withLabels(metrics.NewGaugeMetric("ProcessRSS", float64(total.rss)), labels),
+			withLabels(metrics.NewGaugeMetric("ProcessCPUPercent", total.cpuPercent), labels),
+			withLabels(metrics.NewGaugeMetric("ProcessOpenFDs", float64(total.fds)), labels),
+			withLabels(metrics.NewGaugeMetric("ProcessThreads", float64(total.threads)), labels),
+			withLabels(metrics.NewGaugeMetric("ProcessUptime", total.uptime.Seconds()), labels),
+		)
+	}
+	c.procs = procs
+
+	if err := errors.Join(errs...); err != nil {
+		return res, fmt.Errorf("collector.process: %w", err)
+	}
+	return res, nil
+}
+
+// match returns PIDs of the processes selected by the watch.
+func (c *processCollector) match(ctx context.Context, w watch, all []*process.Process) ([]int32, error) {
+	if w.pidFile != "" {
+		data, err := os.ReadFile(w.pidFile)
+		if err != nil {
+			return nil, fmt.Errorf("collector.process.match: %w", err)
+		}
+		pid, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("collector.process.match: invalid pid file '%s', %w", w.pidFile, err)
+		}
+		if exists, err := process.PidExistsWithContext(ctx, int32(pid)); err != nil || !exists {
+			return nil, err
+		}
+		return []int32{int32(pid)}, nil
+	}
+
+	var pids []int32
+	for _, p := range all {
+		// processes exiting while being matched are skipped
+		if w.exe != "" {
+			if name, err := p.NameWithContext(ctx); err == nil && name == w.exe {
+				pids = append(pids, p.Pid)
+			}
+			continue
+		}
+		if cmdline, err := p.CmdlineWithContext(ctx); err == nil && w.cmdline.MatchString(cmdline) {
+			pids = append(pids, p.Pid)
+		}
+	}
+	return pids, nil
+}
+
+// usage is the resource usage of a process.
+type usage struct {
+	rss        uint64
+	cpuPercent float64
+	fds        int32
+	threads    int32
+	uptime     time.Duration
+}
+
+func collectProcess(ctx context.Context, p *process.Process) (usage, error) {
+	memInfo, err := p.MemoryInfoWithContext(ctx)
+	if err != nil {
+		return usage{}, fmt.Errorf("collector.process.memoryInfo: %w", err)
+	}
+	cpuPercent, err := p.PercentWithContext(ctx, 0)
+	if err != nil {
+		return usage{}, fmt.Errorf("collector.process.cpu: %w", err)
+	}
+	fds, err := p.NumFDsWithContext(ctx)
+	if err != nil {
+		return usage{}, fmt.Errorf("collector.process.fds: %w", err)
+	}
+	threads, err := p.NumThreadsWithContext(ctx)
+	if err != nil {
+		return usage{}, fmt.Errorf("collector.process.threads: %w", err)
+	}
+	createTime, err := p.CreateTimeWithContext(ctx)
+	if err != nil {
+		return usage{}, fmt.Errorf("collector.process.createTime: %w", err)
+	}
+
+	return usage{
+		rss:        memInfo.RSS,
+		cpuPercent: cpuPercent,
+		fds:        fds,
+		threads:    threads,
+		uptime:     time.Since(time.UnixMilli(createTime)),
+	}, nil
+}
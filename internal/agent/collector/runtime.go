@@ -0,0 +1,62 @@
+package collector
+
+import (
+	"context"
+	"math/rand"
+	"runtime"
+
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+)
+
+// RuntimeName is the name of the Go runtime collector.
+const RuntimeName = "runtime"
+
+// runtimeCollector collects memory statistics of the Go runtime and the poll counter.
+type runtimeCollector struct{}
+
+// NewRuntime creates the Go runtime collector.
+func NewRuntime() *runtimeCollector {
+	return &runtimeCollector{}
+}
+
+func (c *runtimeCollector) Name() string {
+	return RuntimeName
+}
+
+func (c *runtimeCollector) Collect(ctx context.Context) ([]metrics.Metric, error) {
+	ms := runtime.MemStats{}
+	runtime.ReadMemStats(&ms)
+
+	return []metrics.Metric{
+		metrics.NewGaugeMetric("Alloc", float64(ms.Alloc)),
+		metrics.NewGaugeMetric("BuckHashSys", float64(ms.BuckHashSys)),
+		metrics.NewGaugeMetric("Frees", float64(ms.Frees)),
+		metrics.NewGaugeMetric("GCCPUFraction", float64(ms.GCCPUFraction)),
+		metrics.NewGaugeMetric("GCSys", float64(ms.GCSys)),
+		metrics.NewGaugeMetric("HeapAlloc", float64(ms.HeapAlloc)),
+		metrics.NewGaugeMetric("HeapIdle", float64(ms.HeapIdle)),
+		metrics.NewGaugeMetric("HeapInuse", float64(ms.HeapInuse)),
+		metrics.NewGaugeMetric("HeapObjects", float64(ms.HeapObjects)),
+		metrics.NewGaugeMetric("HeapReleased", float64(ms.HeapReleased)),
+		metrics.NewGaugeMetric("HeapSys", float64(ms.HeapSys)),
+		metrics.NewGaugeMetric("LastGC", float64(ms.LastGC)),
+		metrics.NewGaugeMetric("Lookups", float64(ms.Lookups)),
+		metrics.NewGaugeMetric("MCacheInuse", float64(ms.MCacheInuse)),
+		metrics.NewGaugeMetric("MCacheSys", float64(ms.MCacheSys)),
+		metrics.NewGaugeMetric("MSpanInuse", float64(ms.MSpanInuse)),
+		metrics.NewGaugeMetric("MSpanSys", float64(ms.MSpanSys)),
+		metrics.NewGaugeMetric("Mallocs", float64(ms.Mallocs)),
+		metrics.NewGaugeMetric("NextGC", float64(ms.NextGC)),
+		metrics.NewGaugeMetric("NumForcedGC", float64(ms.NumForcedGC)),
+		metrics.NewGaugeMetric("NumGC", float64(ms.NumGC)),
+		metrics.NewGaugeMetric("OtherSys", float64(ms.OtherSys)),
+		metrics.NewGaugeMetric("PauseTotalNs", float64(ms.PauseTotalNs)),
+		metrics.NewGaugeMetric("StackInuse", float64(ms.StackInuse)),
+		metrics.NewGaugeMetric("StackSys", float64(ms.StackSys)),
+		metrics.NewGaugeMetric("Sys", float64(ms.Sys)),
+		metrics.NewGaugeMetric("TotalAlloc", float64(ms.TotalAlloc)),
+		metrics.NewGaugeMetric("RandomValue", rand.Float64()),
+
+		metrics.NewCounterMetric("PollCount", 1),
+	}, nil
+}
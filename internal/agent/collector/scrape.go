@@ -0,0 +1,125 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/prometheus"
+)
+
+// ScrapeName is the name of the Prometheus endpoints collector.
+const ScrapeName = "prometheus"
+
+// scrapeTimeout limits scraping of a single endpoint.
+const scrapeTimeout = 10 * time.Second
+
+// scrapeCollector scrapes Prometheus endpoints in the text exposition format.
+//
+// Samples keep their names and labels, and get the "instance" label with the host of the endpoint.
+// Prometheus counters are cumulative, so they are reported as counters of the increase since the previous
+// scrape, truncated to whole numbers. All other samples, including histogram buckets and summary
+// quantiles, are reported as gauges. Samples with infinite or NaN values are skipped.
+type scrapeCollector struct {
+	urls   []string
+	http   *http.Client
+	totals map[string]map[string]float64 // last counter values of every endpoint by series key
+}
+
+// NewScrape creates the collector of the Prometheus endpoints.
+func NewScrape(urls []string) *scrapeCollector {
+	return &scrapeCollector{
+		urls:   urls,
+		http:   &http.Client{Timeout: scrapeTimeout},
+		totals: map[string]map[string]float64{},
+	}
+}
+
+func (c *scrapeCollector) Name() string {
+	return ScrapeName
+}
+
+// Collect scrapes every endpoint. Endpoints failing to be scraped are reported in the error
+// along with the metrics of the others.
+func (c *scrapeCollector) Collect(ctx context.Context) ([]metrics.Metric, error) {
+	var res []metrics.Metric
+	var errs []error
+	for _, u := range c.urls {
+		values, err := c.scrape(ctx, u)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		res = append(res, values...)
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return res, fmt.Errorf("collector.scrape: %w", err)
+	}
+	return res, nil
+}
+
+func (c *scrapeCollector) scrape(ctx context.Context, endpoint string) ([]metrics.Metric, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("collector.scrape: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("collector.scrape: %w", err)
+	}
+	req.Header.Set("Accept", prometheus.ContentType)
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("collector.scrape: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("collector.scrape: unexpected response status '%s' of '%s'", res.Status, endpoint)
+	}
+
+	samples, err := prometheus.Decode(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("collector.scrape: '%s', %w", endpoint, err)
+	}
+
+	// counters missing from the endpoint are forgotten
+	prevTotals := c.totals[endpoint]
+	totals := make(map[string]float64, len(prevTotals))
+	c.totals[endpoint] = totals
+
+	var values []metrics.Metric
+	for _, s := range samples {
+		if math.IsInf(s.Value, 0) || math.IsNaN(s.Value) {
+			continue
+		}
+		labels := map[string]string{"instance": u.Host}
+		maps.Copy(labels, s.Labels)
+
+		if s.Type != prometheus.TypeCounter {
+			values = append(values, withLabels(metrics.NewGaugeMetric(s.Name, s.Value), labels))
+			continue
+		}
+
+		key := metrics.SeriesKey(s.Name, labels)
+		totals[key] = s.Value
+		prev, ok := prevTotals[key]
+		if !ok {
+			continue
+		}
+		// a lower total means the counter was reset
+		delta := math.Floor(s.Value)
+		if s.Value >= prev {
+			delta -= math.Floor(prev)
+		}
+		values = append(values, withLabels(metrics.NewCounterMetric(s.Name, int64(delta)), labels))
+	}
+	return values, nil
+}
@@ -0,0 +1,213 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/load"
+	"github.com/shirou/gopsutil/v3/mem"
+	"github.com/shirou/gopsutil/v3/net"
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+)
+
+// SystemName is the name of the host system collector.
+const SystemName = "system"
+
+// systemCollector collects memory, swap, CPU, load, disk and network statistics of the host.
+//
+// Disk IO and network statistics are cumulative in the OS, so they are reported as counters
+// of the difference since the previous collection. The first collection only records the totals.
+type systemCollector struct {
+	totals map[string]uint64 // last cumulative values by series key
+}
+
+// NewSystem creates the host system collector.
+func NewSystem() *systemCollector {
+	return &systemCollector{totals: map[string]uint64{}}
+}
+
+func (c *systemCollector) Name() string {
+	return SystemName
+}
+
+// Collect returns the host metrics. Failing subsystems are reported in the error
+// along with the metrics of the others.
+func (c *systemCollector) Collect(ctx context.Context) ([]metrics.Metric, error) {
+	var res []metrics.Metric
+	var errs []error
+	for _, collect := range []func(context.Context) ([]metrics.Metric, error){
+		c.collectMemory,
+		c.collectCPU,
+		c.collectLoad,
+		c.collectDiskUsage,
+		c.collectDiskIO,
+		c.collectNetwork,
+	} {
+		values, err := collect(ctx)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		res = append(res, values...)
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return res, fmt.Errorf("collector.system: %w", err)
+	}
+	return res, nil
+}
+
+func (c *systemCollector) collectMemory(ctx context.Context) ([]metrics.Metric, error) {
+	vMem, err := mem.VirtualMemoryWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("collector.system.virtualMemory: %w", err)
+	}
+	swap, err := mem.SwapMemoryWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("collector.system.swapMemory: %w", err)
+	}
+
+	return []metrics.Metric{
+		metrics.NewGaugeMetric("TotalMemory", float64(vMem.Total)),
+		metrics.NewGaugeMetric("FreeMemory", float64(vMem.Free)),
+		metrics.NewGaugeMetric("SwapTotal", float64(swap.Total)),
+		metrics.NewGaugeMetric("SwapUsed", float64(swap.Used)),
+		metrics.NewGaugeMetric("SwapFree", float64(swap.Free)),
+	}, nil
+}
+
+// collectCPU returns the total utilization of all CPUs as CPUutilization1
+// and utilization of every CPU as CPUCoreUtilization labelled by its number in the "cpu" label.
+func (c *systemCollector) collectCPU(ctx context.Context) ([]metrics.Metric, error) {
+	total, err := cpu.PercentWithContext(ctx, 0, false)
+	if err != nil {
+		return nil, fmt.Errorf("collector.system.cpu: %w", err)
+	}
+	perCPU, err := cpu.PercentWithContext(ctx, 0, true)
+	if err != nil {
+		return nil, fmt.Errorf("collector.system.cpu: %w", err)
+	}
+
+	res := make([]metrics.Metric, 0, len(perCPU)+1)
+	if len(total) > 0 {
+		res = append(res, metrics.NewGaugeMetric("CPUutilization1", total[0]))
+	}
+	for i, u := range perCPU {
+		res = append(res, withLabels(metrics.NewGaugeMetric("CPUCoreUtilization", u), map[string]string{"cpu": strconv.Itoa(i)}))
+	}
+	return res, nil
+}
+
+func (c *systemCollector) collectLoad(ctx context.Context) ([]metrics.Metric, error) {
+	avg, err := load.AvgWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("collector.system.load: %w", err)
+	}
+
+	return []metrics.Metric{
+		metrics.NewGaugeMetric("LoadAverage1", avg.Load1),
+		metrics.NewGaugeMetric("LoadAverage5", avg.Load5),
+		metrics.NewGaugeMetric("LoadAverage15", avg.Load15),
+	}, nil
+}
+
+// collectDiskUsage returns usage of every mounted physical partition labelled by its mountpoint.
+func (c *systemCollector) collectDiskUsage(ctx context.Context) ([]metrics.Metric, error) {
+	partitions, err := disk.PartitionsWithContext(ctx, false)
+	if err != nil {
+		return nil, fmt.Errorf("collector.system.partitions: %w", err)
+	}
+
+	var res []metrics.Metric
+	var errs []error
+	seen := map[string]bool{}
+	for _, p := range partitions {
+		if seen[p.Mountpoint] {
+			continue
+		}
+		seen[p.Mountpoint] = true
+
+		usage, err := disk.UsageWithContext(ctx, p.Mountpoint)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		labels := map[string]string{"mountpoint": p.Mountpoint, "device": p.Device}
+		res = append(res,
+			withLabels(metrics.NewGaugeMetric("DiskTotalBytes", float64(usage.Total)), labels),
+			withLabels(metrics.NewGaugeMetric("DiskUsedBytes", float64(usage.Used)), labels),
+			withLabels(metrics.NewGaugeMetric("DiskFreeBytes", float64(usage.Free)), labels),
+			withLabels(metrics.NewGaugeMetric("DiskUsedPercent", usage.UsedPercent), labels),
+		)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return res, fmt.Errorf("collector.system.diskUsage: %w", err)
+	}
+	return res, nil
+}
+
+// collectDiskIO returns IO of every block device labelled by its name.
+func (c *systemCollector) collectDiskIO(ctx context.Context) ([]metrics.Metric, error) {
+	counters, err := disk.IOCountersWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("collector.system.diskIO: %w", err)
+	}
+
+	var res []metrics.Metric
+	for name, io := range counters {
+		labels := map[string]string{"device": name}
+		res = c.appendCounter(res, "DiskReadBytes", labels, io.ReadBytes)
+		res = c.appendCounter(res, "DiskWriteBytes", labels, io.WriteBytes)
+		res = c.appendCounter(res, "DiskReads", labels, io.ReadCount)
+		res = c.appendCounter(res, "DiskWrites", labels, io.WriteCount)
+	}
+	return res, nil
+}
+
+// collectNetwork returns traffic and errors of every network interface labelled by its name.
+func (c *systemCollector) collectNetwork(ctx context.Context) ([]metrics.Metric, error) {
+	counters, err := net.IOCountersWithContext(ctx, true)
+	if err != nil {
+		return nil, fmt.Errorf("collector.system.network: %w", err)
+	}
+
+	var res []metrics.Metric
+	for _, io := range counters {
+		labels := map[string]string{"interface": io.Name}
+		res = c.appendCounter(res, "NetBytesSent", labels, io.BytesSent)
+		res = c.appendCounter(res, "NetBytesRecv", labels, io.BytesRecv)
+		res = c.appendCounter(res, "NetPacketsSent", labels, io.PacketsSent)
+		res = c.appendCounter(res, "NetPacketsRecv", labels, io.PacketsRecv)
+		res = c.appendCounter(res, "NetErrIn", labels, io.Errin)
+		res = c.appendCounter(res, "NetErrOut", labels, io.Errout)
+		res = c.appendCounter(res, "NetDropIn", labels, io.Dropin)
+		res = c.appendCounter(res, "NetDropOut", labels, io.Dropout)
+	}
+	return res, nil
+}
+
+// appendCounter records the cumulative total of the series and appends the counter
+// of its increase since the previous collection. A total lower than the previous one
+// means the OS counter was reset, then the whole total is the increase.
+func (c *systemCollector) appendCounter(res []metrics.Metric, id string, labels map[string]string, total uint64) []metrics.Metric {
+	key := metrics.SeriesKey(id, labels)
+	prev, ok := c.totals[key]
+	c.totals[key] = total
+	if !ok {
+		return res
+	}
+
+	delta := total
+	if total >= prev {
+		delta = total - prev
+	}
+	return append(res, withLabels(metrics.NewCounterMetric(id, int64(delta)), labels))
+}
+
+func withLabels(m metrics.Metric, labels map[string]string) metrics.Metric {
+	m.Labels = labels
+	return m
+}
@@ -7,7 +7,9 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"net/url"
 	"os"
+	"regexp"
 	"strings"
 	"time"
 
@@ -26,6 +28,31 @@ type Config struct {
 	HashKey        string `env:"KEY" json:"key"`                         // Key for signing metrics data.
 	CryptoKey      string `env:"CRYPTO_KEY" json:"crypto_key"`           // Public key for data encryption.
 	Protocol       string `env:"PROTOCOL" json:"protocol"`               // Protocol to connect to server (http/grpc).
+	BatchSize      int    `env:"BATCH_SIZE" json:"batch_size"`           // Maximum number of metrics sent in a single http request.
+	SpoolPath      string `env:"SPOOL_PATH" json:"spool_path"`           // Directory keeping unsent metrics, spooling is off unless set.
+	SpoolSize      int    `env:"SPOOL_SIZE" json:"spool_size"`           // Maximum size of the spool on disk, in megabytes.
+	StatsdAddr     string `env:"STATSD_ADDRESS" json:"statsd_address"`   // UDP address of the StatsD listener, empty to disable it.
+	StatsdSocket   string `env:"STATSD_SOCKET" json:"statsd_socket"`     // Unix datagram socket of the StatsD listener, empty to disable it.
+	PushAddr       string `env:"PUSH_ADDRESS" json:"push_address"`       // Local address of the push API, e.g. "localhost:8081", empty to disable it.
+	ScrapeURLs     string `env:"SCRAPE_URLS" json:"scrape_urls"`         // Comma separated Prometheus endpoints scraped by the agent.
+
+	Collectors map[string]CollectorConfig `json:"collectors"` // Settings of metric collectors by collector name, set in the config file only.
+	Processes  []ProcessConfig            `json:"processes"`  // Processes watched by the process collector, set in the config file only.
+}
+
+// CollectorConfig holds the settings of a single metric collector.
+type CollectorConfig struct {
+	Disabled     bool `json:"disabled"`      // Whether the collector is not polled.
+	PollInterval int  `json:"poll_interval"` // Interval for polling the collector, in seconds. Zero means Config.PollInterval.
+}
+
+// ProcessConfig selects processes watched by the process collector. Exactly one of
+// PIDFile, Exe and Cmdline is set.
+type ProcessConfig struct {
+	Name    string `json:"name"`     // Name of the watch reported in the "process" label.
+	PIDFile string `json:"pid_file"` // File containing the PID of the process.
+	Exe     string `json:"exe"`      // Name of the process executable.
+	Cmdline string `json:"cmdline"`  // Regular expression matched against the process command line.
 }
 
 // Parse parses the configuration from command-line flags and environment variables.
@@ -58,6 +85,13 @@ func Parse() (*Config, error) {
 	flag.StringVar(&conf.CryptoKey, "crypto-key", conf.CryptoKey, "public key for data encryption")
 	flag.StringVar(&configFile, "c", configFile, "json file with configuration")
 	flag.StringVar(&conf.Protocol, "pr", conf.Protocol, "protocol to connect to server (http/grpc)")
+	flag.IntVar(&conf.BatchSize, "b", conf.BatchSize, "maximum number of metrics sent in a single http request")
+	flag.StringVar(&conf.SpoolPath, "spool", conf.SpoolPath, "directory keeping unsent metrics, spooling is off if empty")
+	flag.IntVar(&conf.SpoolSize, "spool-size", conf.SpoolSize, "maximum size of the spool in megabytes")
+	flag.StringVar(&conf.StatsdAddr, "statsd", conf.StatsdAddr, "udp address of the statsd listener")
+	flag.StringVar(&conf.StatsdSocket, "statsd-socket", conf.StatsdSocket, "unix datagram socket of the statsd listener")
+	flag.StringVar(&conf.PushAddr, "push", conf.PushAddr, "local address of the push api")
+	flag.StringVar(&conf.ScrapeURLs, "scrape-urls", conf.ScrapeURLs, "comma separated prometheus endpoints to scrape")
 	flag.Parse()
 
 	err = env.Parse(&conf)
@@ -74,6 +108,25 @@ func Parse() (*Config, error) {
 	if conf.RateLimit <= 0 {
 		return nil, errors.New("config.parse: negative or zero rate interval")
 	}
+	if conf.BatchSize <= 0 {
+		return nil, errors.New("config.parse: negative or zero batch size")
+	}
+	if conf.SpoolSize <= 0 {
+		return nil, errors.New("config.parse: negative or zero spool size")
+	}
+	for name, c := range conf.Collectors {
+		if c.PollInterval < 0 {
+			return nil, fmt.Errorf("config.parse: negative poll interval of collector '%s'", name)
+		}
+	}
+	if err := validateProcesses(conf.Processes); err != nil {
+		return nil, fmt.Errorf("config.parse: %w", err)
+	}
+	for _, u := range conf.GetScrapeURLs() {
+		if _, err = url.ParseRequestURI(u); err != nil {
+			return nil, fmt.Errorf("config.parse: invalid scrape url: %w", err)
+		}
+	}
 
 	return &conf, nil
 }
@@ -91,7 +144,37 @@ func GetDefault() (conf *Config) {
 		HashKey:        "",
 		CryptoKey:      "",
 		Protocol:       "http",
+		BatchSize:      100,
+		SpoolPath:      "",
+		SpoolSize:      10,
+	}
+}
+
+func validateProcesses(processes []ProcessConfig) error {
+	names := map[string]bool{}
+	for _, p := range processes {
+		if p.Name == "" {
+			return errors.New("config.validateProcesses: empty process name")
+		}
+		if names[p.Name] {
+			return fmt.Errorf("config.validateProcesses: duplicate process name '%s'", p.Name)
+		}
+		names[p.Name] = true
+
+		selectors := 0
+		for _, s := range []string{p.PIDFile, p.Exe, p.Cmdline} {
+			if s != "" {
+				selectors++
+			}
+		}
+		if selectors != 1 {
+			return fmt.Errorf("config.validateProcesses: process '%s' must set exactly one of pid_file, exe and cmdline", p.Name)
+		}
+		if _, err := regexp.Compile(p.Cmdline); err != nil {
+			return fmt.Errorf("config.validateProcesses: process '%s', %w", p.Name, err)
+		}
 	}
+	return nil
 }
 
 func getConfigFileName() (configPath string) {
@@ -138,3 +221,34 @@ func (c *Config) GetReportIntervalDuration() time.Duration {
 func (c *Config) GetPollIntervalDuration() time.Duration {
 	return time.Duration(c.PollInterval) * time.Second
 }
+
+// GetSpoolSizeBytes converts the SpoolSize field to bytes.
+func (c *Config) GetSpoolSizeBytes() int64 {
+	return int64(c.SpoolSize) << 20
+}
+
+// IsCollectorEnabled reports whether the collector with the name should be polled.
+// Collectors are enabled unless disabled in the config.
+func (c *Config) IsCollectorEnabled(name string) bool {
+	return !c.Collectors[name].Disabled
+}
+
+// GetCollectorPollIntervalDuration returns the poll interval of the collector with the name,
+// falling back to PollInterval.
+func (c *Config) GetCollectorPollIntervalDuration(name string) time.Duration {
+	if interval := c.Collectors[name].PollInterval; interval > 0 {
+		return time.Duration(interval) * time.Second
+	}
+	return c.GetPollIntervalDuration()
+}
+
+// GetScrapeURLs splits the ScrapeURLs field into a list of URLs.
+func (c *Config) GetScrapeURLs() []string {
+	var res []string
+	for _, item := range strings.Split(c.ScrapeURLs, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			res = append(res, item)
+		}
+	}
+	return res
+}
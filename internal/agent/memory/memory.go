@@ -24,38 +24,122 @@ func (s *storage) Set(metric metrics.Metric) error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	switch metric.MType {
-	case metrics.Counter:
-		cur, ok := s.metrics[metric.ID]
-		if ok {
-			newDelta := (metric.GetDelta() + cur.GetDelta())
-			metric.Delta = &newDelta
-			s.metrics[metric.ID] = metric
-		} else {
-			s.metrics[metric.ID] = metric
-		}
-	case metrics.Gauge:
-		s.metrics[metric.ID] = metric
-	default:
-		return errors.ErrMetricTypeNotImplemented
+	merged, err := merge(s.metrics[metric.Key()], metric)
+	if err != nil {
+		return fmt.Errorf("memory.set: %w", err)
 	}
-
+	s.metrics[metric.Key()] = merged
 	return nil
 }
 
+// SetAll stores the metrics under a single lock. Either all metrics are stored,
+// or none of them if any can't be merged into its series.
 func (s *storage) SetAll(meticsSlice []metrics.Metric) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// series are merged aside and stored once the whole batch is merged
+	staged := make(map[string]metrics.Metric, len(meticsSlice))
 	for _, m := range meticsSlice {
-		if err := s.Set(m); err != nil {
+		key := m.Key()
+		cur, ok := staged[key]
+		if !ok {
+			cur = s.metrics[key]
+		}
+		merged, err := merge(cur, m)
+		if err != nil {
 			return fmt.Errorf("memory.setAll: %w", err)
 		}
+		staged[key] = merged
 	}
 
+	for key, m := range staged {
+		s.metrics[key] = m
+	}
 	return nil
 }
 
+// merge returns the series cur updated with the metric. A zero cur is a series not stored yet.
+func merge(cur, metric metrics.Metric) (metrics.Metric, error) {
+	switch metric.MType {
+	case metrics.Counter:
+		if cur.Delta != nil {
+			newDelta := metric.GetDelta() + cur.GetDelta()
+			metric.Delta = &newDelta
+		}
+		return metric, nil
+	case metrics.Gauge:
+		return metric, nil
+	case metrics.Histogram:
+		merged, err := metrics.MergeHistogram(cur, metric)
+		if err != nil {
+			return cur, fmt.Errorf("memory.merge: %w", err)
+		}
+		return merged, nil
+	case metrics.Summary:
+		merged, err := metrics.MergeSummary(cur, metric)
+		if err != nil {
+			return cur, fmt.Errorf("memory.merge: %w", err)
+		}
+		return merged, nil
+	default:
+		return cur, errors.ErrMetricTypeNotImplemented
+	}
+}
+
+// GetAll returns a snapshot of stored metrics by series key.
 func (s *storage) GetAll() map[string]metrics.Metric {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
-	return s.metrics
+	res := make(map[string]metrics.Metric, len(s.metrics))
+	for key, m := range s.metrics {
+		res[key] = m
+	}
+	return res
+}
+
+// Ack subtracts counter deltas, histogram and summary observations of the reported metrics
+// from the stored ones, so that only values added since the snapshot are reported next time.
+// Series with nothing left to report are removed.
+func (s *storage) Ack(batch []metrics.Metric) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, m := range batch {
+		key := m.Key()
+		cur, ok := s.metrics[key]
+		if !ok || cur.MType != m.MType {
+			continue
+		}
+
+		switch m.MType {
+		case metrics.Counter:
+			delta := cur.GetDelta() - m.GetDelta()
+			if delta == 0 {
+				delete(s.metrics, key)
+				continue
+			}
+			cur.Delta = &delta
+		case metrics.Histogram, metrics.Summary:
+			count := cur.GetCount() - m.GetCount()
+			if count == 0 {
+				delete(s.metrics, key)
+				continue
+			}
+			sum := cur.GetSum() - m.GetSum()
+			cur.Count = &count
+			cur.Sum = &sum
+			if len(cur.Buckets) == len(m.Buckets) {
+				buckets := make([]metrics.Bucket, len(cur.Buckets))
+				for i, b := range cur.Buckets {
+					buckets[i] = metrics.Bucket{UpperBound: b.UpperBound, Count: b.Count - m.Buckets[i].Count}
+				}
+				cur.Buckets = buckets
+			}
+		default:
+			continue
+		}
+		s.metrics[key] = cur
+	}
 }
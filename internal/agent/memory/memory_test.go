@@ -3,6 +3,8 @@ package memory_test
 import (
 	"testing"
 
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/ulixes-bloom/ya-metrics/internal/agent/memory"
 	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
 )
@@ -38,3 +40,62 @@ func BenchmarkSetAll(b *testing.B) {
 		s.SetAll(metricsToSet)
 	}
 }
+
+func TestAck(t *testing.T) {
+	s := memory.NewStorage()
+	histogram := metrics.NewHistogramMetric("Latency", []float64{0.1, 1})
+	histogram.Observe(0.05)
+	histogram.Observe(0.5)
+	require.NoError(t, s.SetAll([]metrics.Metric{
+		metrics.NewCounterMetric("PollCount", 3),
+		metrics.NewGaugeMetric("Alloc", 1),
+		histogram,
+	}))
+
+	snapshot := s.GetAll()
+
+	// values added after the snapshot stay pending after the acknowledgement
+	require.NoError(t, s.Set(metrics.NewCounterMetric("PollCount", 2)))
+	more := metrics.NewHistogramMetric("Latency", []float64{0.1, 1})
+	more.Observe(0.05)
+	require.NoError(t, s.Set(more))
+
+	batch := make([]metrics.Metric, 0, len(snapshot))
+	for _, m := range snapshot {
+		batch = append(batch, m)
+	}
+	s.Ack(batch)
+
+	pending := s.GetAll()
+	counter, gauge, latency := pending["PollCount"], pending["Alloc"], pending["Latency"]
+	assert.Equal(t, int64(2), counter.GetDelta())
+	assert.Equal(t, float64(1), gauge.GetValue())
+	assert.Equal(t, uint64(1), latency.GetCount())
+	assert.Equal(t, []metrics.Bucket{{UpperBound: 0.1, Count: 1}, {UpperBound: 1, Count: 1}}, latency.Buckets)
+
+	// series without pending values are not reported again
+	s.Ack([]metrics.Metric{counter, latency})
+	pending = s.GetAll()
+	assert.NotContains(t, pending, "PollCount")
+	assert.NotContains(t, pending, "Latency")
+	assert.Contains(t, pending, "Alloc")
+}
+
+func TestSetAllAtomic(t *testing.T) {
+	s := memory.NewStorage()
+	require.NoError(t, s.Set(metrics.NewHistogramMetric("Latency", []float64{1})))
+
+	err := s.SetAll([]metrics.Metric{
+		metrics.NewCounterMetric("PollCount", 1),
+		metrics.NewHistogramMetric("Latency", []float64{2}),
+	})
+	require.Error(t, err)
+	assert.NotContains(t, s.GetAll(), "PollCount", "no metric of a failed batch is stored")
+
+	require.NoError(t, s.SetAll([]metrics.Metric{
+		metrics.NewCounterMetric("PollCount", 1),
+		metrics.NewCounterMetric("PollCount", 2),
+	}))
+	pollCount := s.GetAll()["PollCount"]
+	assert.Equal(t, int64(3), pollCount.GetDelta())
+}
@@ -0,0 +1,8 @@
+package push
+
+import "github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+
+type Storage interface {
+	Set(value metrics.Metric) error
+	SetAll(meticsSlice []metrics.Metric) error
+}
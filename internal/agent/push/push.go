@@ -0,0 +1,147 @@
+// Package push provides the local HTTP API of the agent, accepting the metrics JSON
+// of the server "/update/" and "/updates/" endpoints from applications running next to the agent.
+//
+// Pushed metrics are merged into the agent storage and reported to the server with the polled ones,
+// so applications reuse the signing, encryption and retries of the agent instead of implementing them.
+// The API is not authenticated and is meant to listen on localhost only.
+package push
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+	"github.com/ulixes-bloom/ya-metrics/internal/agent/config"
+	appErrors "github.com/ulixes-bloom/ya-metrics/internal/pkg/errors"
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/headers"
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+)
+
+// shutdownTimeout limits waiting for requests in progress when the API stops.
+const shutdownTimeout = 5 * time.Second
+
+type pushAPI struct {
+	storage Storage
+	conf    *config.Config
+	router  *chi.Mux
+}
+
+// New creates the push API storing received metrics in the storage.
+func New(conf *config.Config, storage Storage) *pushAPI {
+	a := pushAPI{
+		storage: storage,
+		conf:    conf,
+	}
+	a.router = a.newRouter()
+	return &a
+}
+
+// Run serves the API on config.PushAddr until the context is done.
+func (a *pushAPI) Run(ctx context.Context) error {
+	srv := http.Server{
+		Addr:    a.conf.PushAddr,
+		Handler: a.router,
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- srv.ListenAndServe()
+	}()
+	log.Info().Str("addr", a.conf.PushAddr).Msg("push api started")
+
+	select {
+	case err := <-errChan:
+		return fmt.Errorf("push.run: %w", err)
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			return fmt.Errorf("push.run: %w", err)
+		}
+		return nil
+	}
+}
+
+func (a *pushAPI) newRouter() *chi.Mux {
+	r := chi.NewRouter()
+	r.Post("/update/", a.UpdateJSONMetric)
+	r.Post("/updates/", a.UpdateMetrics)
+	return r
+}
+
+// UpdateJSONMetric handles the HTTP request to push a single metric JSON object.
+// It responds with the accepted metric.
+func (a *pushAPI) UpdateJSONMetric(res http.ResponseWriter, req *http.Request) {
+	var m metrics.Metric
+	if err := json.NewDecoder(req.Body).Decode(&m); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validate(m); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := a.storage.Set(m); err != nil {
+		log.Error().Msg(err.Error())
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res.Header().Add(headers.ContentType, "application/json")
+	res.WriteHeader(http.StatusOK)
+	json.NewEncoder(res).Encode(m)
+}
+
+// UpdateMetrics handles the HTTP request to push a JSON array of metrics.
+// Either all metrics are accepted or none of them if any is invalid.
+func (a *pushAPI) UpdateMetrics(res http.ResponseWriter, req *http.Request) {
+	var batch []metrics.Metric
+	if err := json.NewDecoder(req.Body).Decode(&batch); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, m := range batch {
+		if err := validate(m); err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := a.storage.SetAll(batch); err != nil {
+		log.Error().Msg(err.Error())
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res.Header().Add(headers.ContentType, "application/json")
+	res.WriteHeader(http.StatusOK)
+}
+
+// validate checks that the metric has an id and the value of its type.
+func validate(m metrics.Metric) error {
+	if m.ID == "" {
+		return errors.New("push.validate: missing metric id")
+	}
+
+	var ok bool
+	switch m.MType {
+	case metrics.Counter:
+		ok = m.Delta != nil
+	case metrics.Gauge:
+		ok = m.Value != nil
+	case metrics.Histogram, metrics.Summary:
+		ok = m.Count != nil && m.Sum != nil
+	default:
+		return fmt.Errorf("push.validate: '%s', %w", m.MType, appErrors.ErrMetricTypeNotImplemented)
+	}
+	if !ok {
+		return fmt.Errorf("push.validate: '%s', %w", m.ID, appErrors.ErrMetricValueNotValid)
+	}
+	return nil
+}
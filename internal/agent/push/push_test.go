@@ -0,0 +1,83 @@
+package push
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ulixes-bloom/ya-metrics/internal/agent/config"
+	"github.com/ulixes-bloom/ya-metrics/internal/agent/memory"
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+)
+
+func TestPush(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		body     string
+		wantCode int
+		want     map[string]metrics.Metric
+	}{
+		{
+			name:     "Single metric",
+			path:     "/update/",
+			body:     `{"id":"Requests","type":"counter","delta":3,"labels":{"route":"/api"}}`,
+			wantCode: http.StatusOK,
+			want: map[string]metrics.Metric{
+				`Requests{route="/api"}`: {ID: "Requests", MType: metrics.Counter, Delta: ptr(int64(3)), Labels: map[string]string{"route": "/api"}},
+			},
+		},
+		{
+			name:     "Batch of metrics",
+			path:     "/updates/",
+			body:     `[{"id":"Requests","type":"counter","delta":1},{"id":"Queue","type":"gauge","value":2.5}]`,
+			wantCode: http.StatusOK,
+			want: map[string]metrics.Metric{
+				"Requests": metrics.NewCounterMetric("Requests", 1),
+				"Queue":    metrics.NewGaugeMetric("Queue", 2.5),
+			},
+		},
+		{
+			name:     "Batch with a metric without value is rejected",
+			path:     "/updates/",
+			body:     `[{"id":"Requests","type":"counter","delta":1},{"id":"Queue","type":"gauge"}]`,
+			wantCode: http.StatusBadRequest,
+			want:     map[string]metrics.Metric{},
+		},
+		{
+			name:     "Unknown metric type",
+			path:     "/update/",
+			body:     `{"id":"Requests","type":"meter","value":1}`,
+			wantCode: http.StatusBadRequest,
+			want:     map[string]metrics.Metric{},
+		},
+		{
+			name:     "Invalid JSON",
+			path:     "/update/",
+			body:     `{"id":`,
+			wantCode: http.StatusBadRequest,
+			want:     map[string]metrics.Metric{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			storage := memory.NewStorage()
+			a := New(config.GetDefault(), storage)
+
+			req := httptest.NewRequest(http.MethodPost, test.path, strings.NewReader(test.body))
+			res := httptest.NewRecorder()
+			a.router.ServeHTTP(res, req)
+
+			require.Equal(t, test.wantCode, res.Code)
+			assert.Equal(t, test.want, storage.GetAll())
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -1,9 +1,17 @@
 package service
 
-import "github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+import (
+	"github.com/ulixes-bloom/ya-metrics/internal/agent/collector"
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+)
 
 type Storage interface {
 	Set(value metrics.Metric) error
 	SetAll(meticsSlice []metrics.Metric) error
 	GetAll() map[string]metrics.Metric
+	Ack(batch []metrics.Metric)
+}
+
+type Registry interface {
+	Collectors() []collector.Collector
 }
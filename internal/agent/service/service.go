@@ -2,118 +2,87 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"math/rand"
-	"runtime"
+	"sync"
+	"time"
 
-	"github.com/shirou/gopsutil/v3/cpu"
-	"github.com/shirou/gopsutil/v3/mem"
+	"github.com/rs/zerolog/log"
+	"github.com/ulixes-bloom/ya-metrics/internal/agent/collector"
+	"github.com/ulixes-bloom/ya-metrics/internal/agent/config"
 	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
-	"golang.org/x/sync/errgroup"
 )
 
 type service struct {
-	storage Storage
+	storage  Storage
+	registry Registry
+	conf     *config.Config
 }
 
-func New(storage Storage) *service {
-	return &service{storage: storage}
+func New(conf *config.Config, storage Storage, registry Registry) *service {
+	return &service{
+		storage:  storage,
+		registry: registry,
+		conf:     conf,
+	}
 }
 
-func (s *service) Poll(ctx context.Context) error {
-	g, ctx := errgroup.WithContext(ctx)
-
-	g.Go(func() error {
-		err := s.pollRuntimeMetrics()
-		if err != nil {
-			return fmt.Errorf("service.poll: %w", err)
-		}
-		return nil
-	})
-	g.Go(func() error {
-		err := s.pollSystemMetrics(ctx)
-		if err != nil {
-			return fmt.Errorf("service.poll: %w", err)
+// Run polls every enabled collector of the registry with its own interval until the context is done.
+func (s *service) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, c := range s.registry.Collectors() {
+		if !s.conf.IsCollectorEnabled(c.Name()) {
+			log.Info().Str("collector", c.Name()).Msg("collector is disabled")
+			continue
 		}
-		return nil
-	})
 
-	if err := g.Wait(); err != nil {
-		return fmt.Errorf("service.poll: %w", err)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.runCollector(ctx, c, s.conf.GetCollectorPollIntervalDuration(c.Name()))
+		}()
 	}
-	return nil
+	wg.Wait()
 }
 
-func (s *service) pollRuntimeMetrics() error {
-	ms := runtime.MemStats{}
-	runtime.ReadMemStats(&ms)
-
-	metricsValues := []metrics.Metric{
-		metrics.NewGaugeMetric("Alloc", float64(ms.Alloc)),
-		metrics.NewGaugeMetric("BuckHashSys", float64(ms.BuckHashSys)),
-		metrics.NewGaugeMetric("Frees", float64(ms.Frees)),
-		metrics.NewGaugeMetric("GCCPUFraction", float64(ms.GCCPUFraction)),
-		metrics.NewGaugeMetric("GCSys", float64(ms.GCSys)),
-		metrics.NewGaugeMetric("HeapAlloc", float64(ms.HeapAlloc)),
-		metrics.NewGaugeMetric("HeapIdle", float64(ms.HeapIdle)),
-		metrics.NewGaugeMetric("HeapInuse", float64(ms.HeapInuse)),
-		metrics.NewGaugeMetric("HeapObjects", float64(ms.HeapObjects)),
-		metrics.NewGaugeMetric("HeapReleased", float64(ms.HeapReleased)),
-		metrics.NewGaugeMetric("HeapSys", float64(ms.HeapSys)),
-		metrics.NewGaugeMetric("LastGC", float64(ms.LastGC)),
-		metrics.NewGaugeMetric("Lookups", float64(ms.Lookups)),
-		metrics.NewGaugeMetric("MCacheInuse", float64(ms.MCacheInuse)),
-		metrics.NewGaugeMetric("MCacheSys", float64(ms.MCacheSys)),
-		metrics.NewGaugeMetric("MSpanInuse", float64(ms.MSpanInuse)),
-		metrics.NewGaugeMetric("MSpanSys", float64(ms.MSpanSys)),
-		metrics.NewGaugeMetric("Mallocs", float64(ms.Mallocs)),
-		metrics.NewGaugeMetric("NextGC", float64(ms.NextGC)),
-		metrics.NewGaugeMetric("NumForcedGC", float64(ms.NumForcedGC)),
-		metrics.NewGaugeMetric("NumGC", float64(ms.NumGC)),
-		metrics.NewGaugeMetric("OtherSys", float64(ms.OtherSys)),
-		metrics.NewGaugeMetric("PauseTotalNs", float64(ms.PauseTotalNs)),
-		metrics.NewGaugeMetric("StackInuse", float64(ms.StackInuse)),
-		metrics.NewGaugeMetric("StackSys", float64(ms.StackSys)),
-		metrics.NewGaugeMetric("Sys", float64(ms.Sys)),
-		metrics.NewGaugeMetric("TotalAlloc", float64(ms.TotalAlloc)),
-		metrics.NewGaugeMetric("RandomValue", rand.Float64()),
-
-		metrics.NewCounterMetric("PollCount", 1),
-	}
-
-	err := s.storage.SetAll(metricsValues)
-	if err != nil {
-		return fmt.Errorf("service.pollRuntimeMetrics: %w", err)
+// runCollector periodically polls the collector and stores its metrics.
+func (s *service) runCollector(ctx context.Context, c collector.Collector, interval time.Duration) {
+	pollTicker := time.NewTicker(interval)
+	defer pollTicker.Stop()
+
+	for {
+		select {
+		case <-pollTicker.C:
+			if err := s.poll(ctx, c); err != nil {
+				log.Error().Str("collector", c.Name()).Msg(err.Error())
+			}
+		case <-ctx.Done():
+			log.Debug().Str("collector", c.Name()).Msg("done polling metrics")
+			return
+		}
 	}
-
-	return nil
 }
 
-func (s *service) pollSystemMetrics(ctx context.Context) error {
-	vMem, err := mem.VirtualMemory()
-	if err != nil {
-		return fmt.Errorf("service.pollSystemMetrics.virtualMemory: %w", err)
-	}
-
-	utilisation, err := cpu.PercentWithContext(ctx, 0, false)
-	if err != nil {
-		return fmt.Errorf("service.pollSystemMetrics.cpu: %w", err)
-	}
-
-	metricsValues := []metrics.Metric{
-		metrics.NewGaugeMetric("TotalMemory", float64(vMem.Total)),
-		metrics.NewGaugeMetric("FreeMemory", float64(vMem.Free)),
-		metrics.NewGaugeMetric("CPUutilization1", float64(utilisation[0])),
+// poll collects metrics of the collector and stores them.
+// Metrics returned along with a collection error are stored as well.
+func (s *service) poll(ctx context.Context, c collector.Collector) error {
+	values, collectErr := c.Collect(ctx)
+	if len(values) > 0 {
+		if err := s.storage.SetAll(values); err != nil {
+			return fmt.Errorf("service.poll: %w", errors.Join(collectErr, err))
+		}
 	}
-
-	err = s.storage.SetAll(metricsValues)
-	if err != nil {
-		return fmt.Errorf("service.pollSystemMetrics: %w", err)
+	if collectErr != nil {
+		return fmt.Errorf("service.poll: %w", collectErr)
 	}
-
 	return nil
 }
 
 func (s *service) GetAll() map[string]metrics.Metric {
 	return s.storage.GetAll()
 }
+
+// Ack marks the metrics as delivered, so their counter deltas and observations are not reported again.
+func (s *service) Ack(batch []metrics.Metric) {
+	s.storage.Ack(batch)
+}
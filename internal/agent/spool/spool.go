@@ -0,0 +1,221 @@
+// Package spool provides a bounded on-disk queue of metric batches the agent failed to send.
+//
+// Every batch is stored in its own file named by a sequence number, so batches are replayed
+// in the order they were spooled, also after the agent restarts. Files are written to a
+// temporary name first and renamed, so a crash never leaves a partially written batch.
+package spool
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+)
+
+// ErrFull is returned when a batch does not fit into the spool size limit.
+var ErrFull = errors.New("spool is full")
+
+const (
+	batchExt = ".json"
+	tmpExt   = ".tmp"
+)
+
+type spool struct {
+	dir     string
+	maxSize int64  // limit of the total size of spooled batches in bytes
+	size    int64  // total size of spooled batches in bytes
+	next    uint64 // sequence number of the next spooled batch
+	mutex   sync.Mutex
+}
+
+// New opens the spool in the directory, creating it if needed. Batches left by a previous run are kept.
+func New(dir string, maxSize int64) (*spool, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("spool.new: %w", err)
+	}
+
+	s := spool{
+		dir:     dir,
+		maxSize: maxSize,
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("spool.new: %w", err)
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasSuffix(name, tmpExt) {
+			// leftover of an interrupted write
+			os.Remove(filepath.Join(dir, name))
+			continue
+		}
+		seq, ok := parseName(name)
+		if !ok {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, fmt.Errorf("spool.new: %w", err)
+		}
+		s.size += info.Size()
+		s.next = max(s.next, seq+1)
+	}
+
+	return &s, nil
+}
+
+// Push appends the batch to the end of the queue.
+func (s *spool) Push(batch []metrics.Metric) error {
+	data, err := json.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("spool.push: %w", err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.size+int64(len(data)) > s.maxSize {
+		return fmt.Errorf("spool.push: %w", ErrFull)
+	}
+	if err := s.write(formatName(s.next), data); err != nil {
+		return fmt.Errorf("spool.push: %w", err)
+	}
+	s.size += int64(len(data))
+	s.next++
+	return nil
+}
+
+// Peek returns the oldest batch and its id. The id is empty if the spool is empty.
+// Unreadable batches are dropped.
+func (s *spool) Peek() (string, []metrics.Metric, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	names, err := s.names()
+	if err != nil {
+		return "", nil, fmt.Errorf("spool.peek: %w", err)
+	}
+
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(s.dir, name))
+		if err != nil {
+			return "", nil, fmt.Errorf("spool.peek: %w", err)
+		}
+
+		var batch []metrics.Metric
+		if err := json.Unmarshal(data, &batch); err != nil {
+			log.Warn().Str("batch", name).Msgf("dropping unreadable spooled batch, %s", err.Error())
+			if err := s.remove(name); err != nil {
+				return "", nil, fmt.Errorf("spool.peek: %w", err)
+			}
+			continue
+		}
+		return name, batch, nil
+	}
+	return "", nil, nil
+}
+
+// Replace overwrites the batch keeping its position in the queue.
+func (s *spool) Replace(id string, batch []metrics.Metric) error {
+	data, err := json.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("spool.replace: %w", err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	info, err := os.Stat(filepath.Join(s.dir, id))
+	if err != nil {
+		return fmt.Errorf("spool.replace: %w", err)
+	}
+	if err := s.write(id, data); err != nil {
+		return fmt.Errorf("spool.replace: %w", err)
+	}
+	s.size += int64(len(data)) - info.Size()
+	return nil
+}
+
+// Remove deletes the batch from the queue.
+func (s *spool) Remove(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.remove(id); err != nil {
+		return fmt.Errorf("spool.remove: %w", err)
+	}
+	return nil
+}
+
+func (s *spool) remove(name string) error {
+	path := filepath.Join(s.dir, name)
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	s.size -= info.Size()
+	return nil
+}
+
+// write atomically replaces the content of the batch file.
+func (s *spool) write(name string, data []byte) error {
+	tmpPath := filepath.Join(s.dir, name+tmpExt)
+	f, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, filepath.Join(s.dir, name))
+}
+
+// names returns names of the spooled batch files from the oldest to the newest.
+func (s *spool) names() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, e := range entries {
+		if _, ok := parseName(e.Name()); ok {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func formatName(seq uint64) string {
+	return fmt.Sprintf("%020d%s", seq, batchExt)
+}
+
+func parseName(name string) (uint64, bool) {
+	seq, found := strings.CutSuffix(name, batchExt)
+	if !found {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(seq, 10, 64)
+	return n, err == nil
+}
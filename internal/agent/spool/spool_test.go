@@ -0,0 +1,57 @@
+package spool
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+)
+
+func TestSpool(t *testing.T) {
+	dir := t.TempDir()
+	s, err := New(dir, 1024)
+	require.NoError(t, err)
+
+	first := []metrics.Metric{metrics.NewCounterMetric("PollCount", 1), metrics.NewGaugeMetric("Alloc", 1)}
+	second := []metrics.Metric{metrics.NewCounterMetric("PollCount", 2)}
+	require.NoError(t, s.Push(first))
+	require.NoError(t, s.Push(second))
+
+	// batches that do not fit are rejected
+	big := make([]metrics.Metric, 100)
+	for i := range big {
+		big[i] = metrics.NewGaugeMetric("Alloc", float64(i))
+	}
+	assert.ErrorIs(t, s.Push(big), ErrFull)
+
+	// batches are kept after reopening and replayed in order
+	s, err = New(dir, 1024)
+	require.NoError(t, err)
+
+	id, batch, err := s.Peek()
+	require.NoError(t, err)
+	assert.Equal(t, first, batch)
+
+	require.NoError(t, s.Replace(id, first[1:]))
+	id, batch, err = s.Peek()
+	require.NoError(t, err)
+	assert.Equal(t, first[1:], batch)
+
+	require.NoError(t, s.Remove(id))
+	id, batch, err = s.Peek()
+	require.NoError(t, err)
+	assert.Equal(t, second, batch)
+
+	// unreadable batches are dropped
+	require.NoError(t, s.Remove(id))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, formatName(0)), []byte("{"), 0644))
+	s, err = New(dir, 1024)
+	require.NoError(t, err)
+	id, _, err = s.Peek()
+	require.NoError(t, err)
+	assert.Empty(t, id)
+	assert.Zero(t, s.size)
+}
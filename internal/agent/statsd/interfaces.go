@@ -0,0 +1,7 @@
+package statsd
+
+import "github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+
+type Storage interface {
+	SetAll(meticsSlice []metrics.Metric) error
+}
@@ -0,0 +1,78 @@
+package statsd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// StatsD metric types.
+const (
+	typeCounter   = "c"
+	typeGauge     = "g"
+	typeTiming    = "ms"
+	typeHistogram = "h" // DogStatsD alias of timings
+)
+
+// sample is a single parsed StatsD line.
+type sample struct {
+	name     string
+	mtype    string
+	value    float64
+	relative bool    // whether a gauge value is a signed change of the current value
+	rate     float64 // sample rate in (0, 1]
+	labels   map[string]string
+}
+
+// parseLine parses a StatsD line "<name>:<value>|<type>[|@<sample rate>][|#<tag>:<value>,...]".
+// DogStatsD tags are returned as labels, tags without a value get an empty label value.
+func parseLine(line string) (sample, error) {
+	name, rest, found := strings.Cut(line, ":")
+	if !found || name == "" {
+		return sample{}, fmt.Errorf("statsd.parseLine: missing metric name in '%s'", line)
+	}
+
+	fields := strings.Split(rest, "|")
+	if len(fields) < 2 {
+		return sample{}, fmt.Errorf("statsd.parseLine: missing metric type in '%s'", line)
+	}
+
+	s := sample{name: name, mtype: fields[1], rate: 1}
+	switch s.mtype {
+	case typeCounter, typeGauge, typeTiming, typeHistogram:
+	default:
+		return sample{}, fmt.Errorf("statsd.parseLine: unknown metric type '%s'", s.mtype)
+	}
+
+	value := fields[0]
+	if s.mtype == typeGauge && (strings.HasPrefix(value, "+") || strings.HasPrefix(value, "-")) {
+		s.relative = true
+	}
+	var err error
+	if s.value, err = strconv.ParseFloat(value, 64); err != nil {
+		return sample{}, fmt.Errorf("statsd.parseLine: invalid value '%s', %w", value, err)
+	}
+
+	for _, f := range fields[2:] {
+		switch {
+		case strings.HasPrefix(f, "@"):
+			rate, err := strconv.ParseFloat(f[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return sample{}, fmt.Errorf("statsd.parseLine: invalid sample rate '%s'", f[1:])
+			}
+			s.rate = rate
+		case strings.HasPrefix(f, "#"):
+			s.labels = map[string]string{}
+			for _, tag := range strings.Split(f[1:], ",") {
+				k, v, _ := strings.Cut(tag, ":")
+				if k != "" {
+					s.labels[k] = v
+				}
+			}
+		default:
+			return sample{}, fmt.Errorf("statsd.parseLine: unknown field '%s'", f)
+		}
+	}
+
+	return s, nil
+}
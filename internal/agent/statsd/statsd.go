@@ -0,0 +1,159 @@
+// Package statsd provides a StatsD-compatible listener, letting applications push custom metrics
+// to the agent over UDP or a Unix datagram socket.
+//
+// Counters ("c"), gauges ("g") and timings ("ms") with sample rates are supported, as well as
+// DogStatsD tags, which become metric labels. Received metrics are aggregated in the agent storage
+// and reported to the server with the polled ones.
+package statsd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	"github.com/ulixes-bloom/ya-metrics/internal/agent/config"
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+)
+
+// maxPacketSize is the maximum size of a UDP datagram payload.
+const maxPacketSize = 65535
+
+// timingBuckets are the upper bounds, in milliseconds, of histogram buckets the timings are observed in.
+var timingBuckets = []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+type listener struct {
+	conf    *config.Config
+	storage Storage
+	gauges  map[string]float64 // last gauge values by series key, base of relative changes
+	mutex   sync.Mutex
+}
+
+// New creates the listener storing received metrics in the storage.
+func New(conf *config.Config, storage Storage) *listener {
+	return &listener{
+		conf:    conf,
+		storage: storage,
+		gauges:  map[string]float64{},
+	}
+}
+
+// Run listens on the UDP address and the Unix datagram socket set in the config until the context is done.
+func (l *listener) Run(ctx context.Context) error {
+	var conns []net.PacketConn
+	if l.conf.StatsdAddr != "" {
+		conn, err := net.ListenPacket("udp", l.conf.StatsdAddr)
+		if err != nil {
+			return fmt.Errorf("statsd.run: %w", err)
+		}
+		conns = append(conns, conn)
+	}
+	if l.conf.StatsdSocket != "" {
+		// remove the socket left by a previous run
+		if err := os.Remove(l.conf.StatsdSocket); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("statsd.run: %w", err)
+		}
+		conn, err := net.ListenPacket("unixgram", l.conf.StatsdSocket)
+		if err != nil {
+			return fmt.Errorf("statsd.run: %w", err)
+		}
+		defer os.Remove(l.conf.StatsdSocket)
+		conns = append(conns, conn)
+	}
+
+	var wg sync.WaitGroup
+	for _, conn := range conns {
+		log.Info().Str("addr", conn.LocalAddr().String()).Msg("statsd listener started")
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.serve(conn)
+		}()
+	}
+
+	<-ctx.Done()
+	for _, conn := range conns {
+		conn.Close()
+	}
+	wg.Wait()
+	log.Debug().Msg("statsd listener stopped")
+	return nil
+}
+
+// serve reads packets from the connection until it is closed.
+func (l *listener) serve(conn net.PacketConn) {
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Error().Msgf("statsd.serve: %s", err.Error())
+			}
+			return
+		}
+		if err := l.handle(string(buf[:n])); err != nil {
+			log.Warn().Msg(err.Error())
+		}
+	}
+}
+
+// handle stores metrics of the newline separated lines of the packet.
+// Invalid lines are skipped and reported in the error.
+func (l *listener) handle(packet string) error {
+	var res []metrics.Metric
+	var errs []error
+	for _, line := range strings.Split(packet, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		s, err := parseLine(line)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		res = append(res, l.toMetric(s))
+	}
+
+	if err := l.storage.SetAll(res); err != nil {
+		errs = append(errs, err)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("statsd.handle: %w", err)
+	}
+	return nil
+}
+
+// toMetric converts the sample to the metric, scaling counters and timings by the sample rate.
+func (l *listener) toMetric(s sample) metrics.Metric {
+	var m metrics.Metric
+	switch s.mtype {
+	case typeCounter:
+		m = metrics.NewCounterMetric(s.name, int64(math.Round(s.value/s.rate)))
+	case typeGauge:
+		l.mutex.Lock()
+		key := metrics.SeriesKey(s.name, s.labels)
+		if s.relative {
+			l.gauges[key] += s.value
+		} else {
+			l.gauges[key] = s.value
+		}
+		m = metrics.NewGaugeMetric(s.name, l.gauges[key])
+		l.mutex.Unlock()
+	default:
+		// a timing sampled at rate r stands for 1/r observations, the weight is capped
+		// so that extremely low rates do not overflow the counts
+		weight := min(max(1, math.Round(1/s.rate)), math.MaxUint32)
+		m = metrics.NewHistogramMetric(s.name, timingBuckets)
+		m.ObserveN(s.value, uint64(weight))
+	}
+	if len(s.labels) > 0 {
+		m.Labels = s.labels
+	}
+	return m
+}
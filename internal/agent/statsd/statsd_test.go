@@ -0,0 +1,135 @@
+package statsd
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ulixes-bloom/ya-metrics/internal/agent/config"
+	"github.com/ulixes-bloom/ya-metrics/internal/agent/memory"
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    sample
+		wantErr bool
+	}{
+		{
+			name: "Counter",
+			line: "requests:3|c",
+			want: sample{name: "requests", mtype: typeCounter, value: 3, rate: 1},
+		},
+		{
+			name: "Sampled counter with tags",
+			line: "requests:1|c|@0.1|#route:/api,canary",
+			want: sample{name: "requests", mtype: typeCounter, value: 1, rate: 0.1, labels: map[string]string{"route": "/api", "canary": ""}},
+		},
+		{
+			name: "Relative gauge",
+			line: "queue:-2|g",
+			want: sample{name: "queue", mtype: typeGauge, value: -2, relative: true, rate: 1},
+		},
+		{
+			name: "Timing",
+			line: "latency:12.5|ms",
+			want: sample{name: "latency", mtype: typeTiming, value: 12.5, rate: 1},
+		},
+		{name: "Missing name", line: ":1|c", wantErr: true},
+		{name: "Missing type", line: "requests:1", wantErr: true},
+		{name: "Unknown type", line: "requests:1|s", wantErr: true},
+		{name: "Invalid value", line: "requests:one|c", wantErr: true},
+		{name: "Invalid sample rate", line: "requests:1|c|@2", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, err := parseLine(test.line)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.want, s)
+		})
+	}
+}
+
+func TestHandle(t *testing.T) {
+	storage := memory.NewStorage()
+	l := New(config.GetDefault(), storage)
+
+	require.NoError(t, l.handle("requests:1|c\nrequests:1|c|@0.5\nqueue:10|g\nqueue:-3|g"))
+	require.NoError(t, l.handle("latency:20|ms|@0.5|#route:/api"))
+	assert.Error(t, l.handle("broken\nrequests:2|c"), "invalid lines are reported")
+
+	all := storage.GetAll()
+	requests := all["requests"]
+	assert.Equal(t, int64(5), requests.GetDelta())
+	queue := all["queue"]
+	assert.Equal(t, float64(7), queue.GetValue())
+
+	latency := all[metrics.SeriesKey("latency", map[string]string{"route": "/api"})]
+	assert.Equal(t, metrics.Histogram, latency.MType)
+	assert.Equal(t, uint64(2), latency.GetCount())
+	assert.Equal(t, float64(40), latency.GetSum())
+
+	require.NoError(t, l.handle("sampled:2|ms|@0.00001"))
+	sampled := storage.GetAll()["sampled"]
+	assert.Equal(t, uint64(100000), sampled.GetCount())
+	assert.Equal(t, float64(200000), sampled.GetSum())
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name    string
+		network string
+	}{
+		{name: "UDP", network: "udp"},
+		{name: "Unix datagram socket", network: "unixgram"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conf := config.GetDefault()
+			addr := "127.0.0.1:0"
+			if test.network == "udp" {
+				// reserve a free port for the listener
+				conn, err := net.ListenPacket("udp", addr)
+				require.NoError(t, err)
+				addr = conn.LocalAddr().String()
+				conn.Close()
+				conf.StatsdAddr = addr
+			} else {
+				addr = filepath.Join(t.TempDir(), "statsd.sock")
+				conf.StatsdSocket = addr
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			storage := memory.NewStorage()
+			done := make(chan error)
+			go func() { done <- New(conf, storage).Run(ctx) }()
+
+			// the listener may not be started yet, so the metric is resent until it is received
+			assert.Eventually(t, func() bool {
+				conn, err := net.Dial(test.network, addr)
+				if err != nil {
+					return false
+				}
+				defer conn.Close()
+				conn.Write([]byte("pushed:1|g"))
+				_, ok := storage.GetAll()["pushed"]
+				return ok
+			}, 5*time.Second, 20*time.Millisecond)
+
+			cancel()
+			assert.NoError(t, <-done)
+		})
+	}
+}
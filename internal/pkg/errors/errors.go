@@ -5,5 +5,10 @@ import "errors"
 var (
 	ErrMetricNotExists          = errors.New("metric not exists")
 	ErrMetricTypeNotImplemented = errors.New("metric type not implemented")
+	ErrMetricTypeMismatch       = errors.New("metric type does not match the stored series")
 	ErrMetricValueNotValid      = errors.New("metric value not valid")
+	ErrHistoryNotEnabled        = errors.New("metrics history not enabled")
+	ErrTooManyPoints            = errors.New("range query exceeds the maximum number of points")
+	ErrWatchNotSupported        = errors.New("metrics watching not supported")
+	ErrDatabaseNotUsed          = errors.New("database not used")
 )
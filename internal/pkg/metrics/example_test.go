@@ -17,3 +17,31 @@ func Example() {
 	// gaugeID gauge 1
 	// counterID counter 1
 }
+
+func ExampleSeriesKey() {
+	fmt.Println(metrics.SeriesKey("Alloc", nil))
+	fmt.Println(metrics.SeriesKey("Alloc", map[string]string{"region": "eu", "host": "a"}))
+
+	// Output:
+	// Alloc
+	// Alloc{host="a",region="eu"}
+}
+
+func ExampleMergeHistogram() {
+	stored := metrics.NewHistogramMetric("latency", []float64{0.1, 0.5})
+	stored.Observe(0.1)
+
+	reported := metrics.NewHistogramMetric("latency", []float64{0.1, 0.5})
+	reported.Observe(0.25)
+	reported.Observe(2)
+
+	merged, err := metrics.MergeHistogram(stored, reported)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(merged.Buckets, merged.GetCount(), merged.GetSum())
+
+	// Output:
+	// [{0.1 1} {0.5 2}] 3 2.35
+}
@@ -0,0 +1,137 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/errors"
+)
+
+// Bucket is a single cumulative histogram bucket:
+// the number of observations less than or equal to UpperBound.
+// The "+Inf" bucket is not stored, it always equals the histogram Count.
+type Bucket struct {
+	UpperBound float64 `json:"le"`
+	Count      uint64  `json:"count"`
+}
+
+// Quantile is a single precomputed summary quantile, e.g. the 0.99 quantile of request latency.
+type Quantile struct {
+	Quantile float64 `json:"quantile"`
+	Value    float64 `json:"value"`
+}
+
+// NewHistogramMetric creates an empty histogram with the given bucket upper bounds.
+// Bounds must be sorted in increasing order.
+func NewHistogramMetric(id string, bounds []float64) Metric {
+	buckets := make([]Bucket, len(bounds))
+	for i, b := range bounds {
+		buckets[i] = Bucket{UpperBound: b}
+	}
+
+	var count uint64
+	var sum float64
+	return Metric{
+		ID:      id,
+		MType:   Histogram,
+		Count:   &count,
+		Sum:     &sum,
+		Buckets: buckets,
+	}
+}
+
+// NewSummaryMetric creates a summary with precomputed quantiles, sum and count of observations.
+func NewSummaryMetric(id string, quantiles []Quantile, sum float64, count uint64) Metric {
+	return Metric{
+		ID:        id,
+		MType:     Summary,
+		Count:     &count,
+		Sum:       &sum,
+		Quantiles: quantiles,
+	}
+}
+
+// Observe adds a single observation to the histogram metric.
+func (m *Metric) Observe(val float64) {
+	m.ObserveN(val, 1)
+}
+
+// ObserveN adds n observations of the same value to the histogram metric.
+func (m *Metric) ObserveN(val float64, n uint64) {
+	for i := range m.Buckets {
+		if val <= m.Buckets[i].UpperBound {
+			m.Buckets[i].Count += n
+		}
+	}
+
+	count := m.GetCount() + n
+	sum := m.GetSum() + val*float64(n)
+	m.Count = &count
+	m.Sum = &sum
+}
+
+// MergeHistogram adds the observations of histogram m to the previously stored histogram cur
+// and returns the result. A zero cur (series not stored yet) is treated as an empty histogram.
+// Both histograms must have the same bucket bounds.
+func MergeHistogram(cur, m Metric) (Metric, error) {
+	if err := validateBuckets(m); err != nil {
+		return m, fmt.Errorf("metrics.mergeHistogram: %w", err)
+	}
+	if cur.Count == nil && len(cur.Buckets) == 0 {
+		return m, nil
+	}
+
+	if len(cur.Buckets) != len(m.Buckets) {
+		return m, fmt.Errorf("metrics.mergeHistogram: bucket bounds changed, %w", errors.ErrMetricValueNotValid)
+	}
+	buckets := make([]Bucket, len(m.Buckets))
+	for i := range m.Buckets {
+		if cur.Buckets[i].UpperBound != m.Buckets[i].UpperBound {
+			return m, fmt.Errorf("metrics.mergeHistogram: bucket bounds changed, %w", errors.ErrMetricValueNotValid)
+		}
+		buckets[i] = Bucket{
+			UpperBound: m.Buckets[i].UpperBound,
+			Count:      cur.Buckets[i].Count + m.Buckets[i].Count,
+		}
+	}
+
+	count := cur.GetCount() + m.GetCount()
+	sum := cur.GetSum() + m.GetSum()
+	m.Buckets = buckets
+	m.Count = &count
+	m.Sum = &sum
+	return m, nil
+}
+
+// MergeSummary adds the count and sum of summary m to the previously stored summary cur
+// and returns the result. Quantiles can not be aggregated, so the latest reported ones are kept.
+func MergeSummary(cur, m Metric) (Metric, error) {
+	for _, q := range m.Quantiles {
+		if q.Quantile < 0 || q.Quantile > 1 || math.IsNaN(q.Quantile) {
+			return m, fmt.Errorf("metrics.mergeSummary: quantile %v out of range, %w", q.Quantile, errors.ErrMetricValueNotValid)
+		}
+	}
+
+	count := cur.GetCount() + m.GetCount()
+	sum := cur.GetSum() + m.GetSum()
+	m.Count = &count
+	m.Sum = &sum
+	return m, nil
+}
+
+// validateBuckets checks that histogram bounds are finite and increasing,
+// and that bucket counts are cumulative.
+func validateBuckets(m Metric) error {
+	for i, b := range m.Buckets {
+		if math.IsInf(b.UpperBound, 0) || math.IsNaN(b.UpperBound) {
+			return fmt.Errorf("metrics.validateBuckets: bucket bound %v is not finite, %w", b.UpperBound, errors.ErrMetricValueNotValid)
+		}
+		if i > 0 && (b.UpperBound <= m.Buckets[i-1].UpperBound || b.Count < m.Buckets[i-1].Count) {
+			return fmt.Errorf("metrics.validateBuckets: buckets are not cumulative, %w", errors.ErrMetricValueNotValid)
+		}
+	}
+	if n := len(m.Buckets); n > 0 && m.Buckets[n-1].Count > m.GetCount() {
+		return fmt.Errorf("metrics.validateBuckets: bucket count exceeds total count, %w", errors.ErrMetricValueNotValid)
+	}
+	return nil
+}
@@ -1,15 +1,27 @@
 // Package metrics provides functionality for defining and operating with metrics,
-// including both "gauge" and "counter" types, and supports serialization to JSON.
+// including "gauge", "counter", "histogram" and "summary" types, and supports serialization to JSON.
 package metrics
 
-import "fmt"
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
 
 // Metric represents a single metric with an ID, type, and a value or delta depending on the metric type.
+// Metrics with the same ID but different labels are stored as separate series.
 type Metric struct {
-	ID    string   `json:"id"`              // Metric name (ID)
-	MType string   `json:"type"`            // Metric type: "gauge" or "counter"
-	Delta *int64   `json:"delta,omitempty"` // Delta value for counter type metrics (optional)
-	Value *float64 `json:"value,omitempty"` // Value for gauge type metrics (optional)
+	ID        string            `json:"id"`                  // Metric name (ID)
+	MType     string            `json:"type"`                // Metric type: "gauge", "counter", "histogram" or "summary"
+	Delta     *int64            `json:"delta,omitempty"`     // Delta value for counter type metrics (optional)
+	Value     *float64          `json:"value,omitempty"`     // Value for gauge type metrics (optional)
+	Count     *uint64           `json:"count,omitempty"`     // Number of observations for histogram and summary metrics (optional)
+	Sum       *float64          `json:"sum,omitempty"`       // Sum of observations for histogram and summary metrics (optional)
+	Buckets   []Bucket          `json:"buckets,omitempty"`   // Cumulative buckets for histogram metrics (optional)
+	Quantiles []Quantile        `json:"quantiles,omitempty"` // Quantiles for summary metrics (optional)
+	Labels    map[string]string `json:"labels,omitempty"`    // Labels identifying the series (optional)
 }
 
 func NewMetric(id, mtype string, val float64, delta int64) (Metric, error) {
@@ -53,8 +65,79 @@ func (m *Metric) GetValue() float64 {
 	return *m.Value
 }
 
+func (m *Metric) GetCount() uint64 {
+	if m.Count == nil {
+		return 0
+	}
+	return *m.Count
+}
+
+func (m *Metric) GetSum() float64 {
+	if m.Sum == nil {
+		return 0
+	}
+	return *m.Sum
+}
+
+// SampleValue returns the value recorded in the series history:
+// the value of a gauge, the accumulated delta of a counter
+// and the number of observations of a histogram or summary.
+func (m *Metric) SampleValue() float64 {
+	switch m.MType {
+	case Counter:
+		return float64(m.GetDelta())
+	case Histogram, Summary:
+		return float64(m.GetCount())
+	default:
+		return m.GetValue()
+	}
+}
+
+// Sample is a value of a single series at a point in time.
+type Sample struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+}
+
+// Key returns the series key of the metric, see SeriesKey.
+func (m *Metric) Key() string {
+	return SeriesKey(m.ID, m.Labels)
+}
+
+// SeriesKey builds the key identifying a single series from the metric ID and labels.
+// Labels are sorted by name, so the key does not depend on map iteration order:
+// a metric without labels is keyed by its bare ID, otherwise the key looks like
+// `Alloc{host="a",region="b"}`.
+func SeriesKey(id string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return id
+	}
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	sb.WriteString(id)
+	sb.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(name)
+		sb.WriteByte('=')
+		sb.WriteString(strconv.Quote(labels[name]))
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
 const Counter = "counter"
 const Gauge = "gauge"
+const Histogram = "histogram"
+const Summary = "summary"
 
 var (
 	CounterMetrics = []string{
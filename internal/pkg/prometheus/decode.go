@@ -0,0 +1,180 @@
+package prometheus
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Prometheus metric types of the # TYPE lines.
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+	TypeSummary   = "summary"
+	TypeUntyped   = "untyped"
+)
+
+// Sample is a single sample line of the text exposition format.
+type Sample struct {
+	Name   string            // Sample name, e.g. "http_requests_total" or "request_latency_bucket".
+	Type   string            // Type of the family the sample belongs to, untyped if it has no # TYPE line.
+	Labels map[string]string // Sample labels, nil if it has none.
+	Value  float64
+}
+
+// Decode reads samples in the Prometheus text exposition format.
+// The _bucket, _sum and _count samples of histograms and _sum and _count samples of summaries
+// get the type of their family. Comments, HELP lines and timestamps are ignored.
+func Decode(r io.Reader) ([]Sample, error) {
+	types := map[string]string{}
+	var res []Sample
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			fields := strings.Fields(line)
+			if len(fields) >= 4 && fields[1] == "TYPE" {
+				types[fields[2]] = fields[3]
+			}
+			continue
+		}
+
+		s, err := parseSample(line)
+		if err != nil {
+			return nil, fmt.Errorf("prometheus.decode: line %d, %w", n, err)
+		}
+		s.Type = familyType(types, s.Name)
+		res = append(res, s)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("prometheus.decode: %w", err)
+	}
+	return res, nil
+}
+
+// familyType returns the type of the family the sample name belongs to.
+func familyType(types map[string]string, name string) string {
+	if t, ok := types[name]; ok {
+		return t
+	}
+	for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+		base, found := strings.CutSuffix(name, suffix)
+		if !found {
+			continue
+		}
+		if t := types[base]; t == TypeHistogram || (t == TypeSummary && suffix != "_bucket") {
+			return t
+		}
+	}
+	return TypeUntyped
+}
+
+// parseSample parses a sample line `name{label="value",...} value [timestamp]`.
+func parseSample(line string) (Sample, error) {
+	var s Sample
+
+	end := strings.IndexAny(line, "{ \t")
+	if end <= 0 {
+		return s, fmt.Errorf("invalid sample '%s'", line)
+	}
+	s.Name = line[:end]
+	rest := line[end:]
+
+	if strings.HasPrefix(rest, "{") {
+		labels, n, err := parseLabels(rest)
+		if err != nil {
+			return s, err
+		}
+		s.Labels = labels
+		rest = rest[n:]
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 || len(fields) > 2 {
+		return s, fmt.Errorf("invalid sample value '%s'", rest)
+	}
+	value, err := parseFloat(fields[0])
+	if err != nil {
+		return s, err
+	}
+	s.Value = value
+	return s, nil
+}
+
+// parseLabels parses the label set at the start of the string and returns it with the length of its text.
+func parseLabels(text string) (map[string]string, int, error) {
+	labels := map[string]string{}
+	i := 1 // skip {
+	for {
+		for i < len(text) && (text[i] == ' ' || text[i] == ',') {
+			i++
+		}
+		if i >= len(text) {
+			return nil, 0, fmt.Errorf("unterminated label set '%s'", text)
+		}
+		if text[i] == '}' {
+			break
+		}
+
+		eq := strings.IndexByte(text[i:], '=')
+		if eq <= 0 {
+			return nil, 0, fmt.Errorf("invalid label in '%s'", text)
+		}
+		name := strings.TrimSpace(text[i : i+eq])
+		i += eq + 1
+		if i >= len(text) || text[i] != '"' {
+			return nil, 0, fmt.Errorf("unquoted value of label '%s'", name)
+		}
+		i++
+
+		var value strings.Builder
+		for ; i < len(text) && text[i] != '"'; i++ {
+			if text[i] == '\\' && i+1 < len(text) {
+				i++
+				switch text[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(text[i])
+				}
+				continue
+			}
+			value.WriteByte(text[i])
+		}
+		if i >= len(text) {
+			return nil, 0, fmt.Errorf("unterminated value of label '%s'", name)
+		}
+		i++ // skip closing quote
+		labels[name] = value.String()
+	}
+
+	if len(labels) == 0 {
+		labels = nil
+	}
+	return labels, i + 1, nil
+}
+
+func parseFloat(val string) (float64, error) {
+	switch val {
+	case "+Inf", "Inf":
+		return math.Inf(1), nil
+	case "-Inf":
+		return math.Inf(-1), nil
+	case "NaN":
+		return math.NaN(), nil
+	}
+	f, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid sample value '%s'", val)
+	}
+	return f, nil
+}
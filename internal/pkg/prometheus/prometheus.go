@@ -0,0 +1,215 @@
+// Package prometheus implements the Prometheus text exposition format for metrics.
+package prometheus
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+)
+
+// ContentType is the content type of the text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Encode writes metrics in the Prometheus text exposition format.
+// Metric and label names are sanitized to match the Prometheus naming rules, and series are
+// grouped into families by the sanitized name, each family is preceded by its # TYPE line.
+// As different IDs may share a sanitized name, a family takes the type of its first series
+// in the order of IDs. Series of another type and series duplicating the sanitized labels
+// of a written series are skipped, as a single conflict makes the whole exposition invalid.
+// For the same reason a family named like a sample of a histogram or summary family,
+// e.g. X_count next to the histogram X, is skipped as a whole.
+func Encode(w io.Writer, metricsSlice []metrics.Metric) error {
+	type series struct {
+		name   string
+		labels map[string]string
+		metric metrics.Metric
+	}
+	sorted := make([]series, 0, len(metricsSlice))
+	for _, m := range metricsSlice {
+		sorted = append(sorted, series{name: sanitizeName(m.ID), labels: sanitizeLabels(m.Labels), metric: m})
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].name != sorted[j].name {
+			return sorted[i].name < sorted[j].name
+		}
+		if sorted[i].metric.ID != sorted[j].metric.ID {
+			return sorted[i].metric.ID < sorted[j].metric.ID
+		}
+		return sorted[i].metric.Key() < sorted[j].metric.Key()
+	})
+
+	bw := bufio.NewWriter(w)
+	var family, familyType string
+	var written map[string]struct{}
+	var skipFamily bool
+	// sample names of the written histogram and summary families. These sort after the name
+	// of their family, so a conflicting family is always met after the one reserving its name.
+	reserved := make(map[string]struct{})
+	for i, s := range sorted {
+		name, labels, m := s.name, s.labels, s.metric
+		if i == 0 || name != family {
+			family, familyType = name, m.MType
+			written = make(map[string]struct{})
+			if _, skipFamily = reserved[name]; skipFamily {
+				continue
+			}
+			switch m.MType {
+			case metrics.Histogram:
+				reserved[name+"_bucket"] = struct{}{}
+				reserved[name+"_sum"] = struct{}{}
+				reserved[name+"_count"] = struct{}{}
+			case metrics.Summary:
+				reserved[name+"_sum"] = struct{}{}
+				reserved[name+"_count"] = struct{}{}
+			}
+			mtype := m.MType
+			if mtype != metrics.Counter && mtype != metrics.Gauge && mtype != metrics.Histogram && mtype != metrics.Summary {
+				mtype = "untyped"
+			}
+			fmt.Fprintf(bw, "# TYPE %s %s\n", name, mtype)
+		}
+
+		if skipFamily || m.MType != familyType {
+			continue
+		}
+		key := metrics.SeriesKey(name, labels)
+		if _, exists := written[key]; exists {
+			continue
+		}
+		written[key] = struct{}{}
+
+		switch m.MType {
+		case metrics.Counter:
+			writeSample(bw, name, labels, "", "", strconv.FormatInt(m.GetDelta(), 10))
+		case metrics.Gauge:
+			writeSample(bw, name, labels, "", "", formatFloat(m.GetValue()))
+		case metrics.Histogram:
+			for _, b := range m.Buckets {
+				writeSample(bw, name+"_bucket", labels, "le", formatFloat(b.UpperBound), strconv.FormatUint(b.Count, 10))
+			}
+			writeSample(bw, name+"_bucket", labels, "le", "+Inf", strconv.FormatUint(m.GetCount(), 10))
+			writeSample(bw, name+"_sum", labels, "", "", formatFloat(m.GetSum()))
+			writeSample(bw, name+"_count", labels, "", "", strconv.FormatUint(m.GetCount(), 10))
+		case metrics.Summary:
+			for _, q := range m.Quantiles {
+				writeSample(bw, name, labels, "quantile", formatFloat(q.Quantile), formatFloat(q.Value))
+			}
+			writeSample(bw, name+"_sum", labels, "", "", formatFloat(m.GetSum()))
+			writeSample(bw, name+"_count", labels, "", "", strconv.FormatUint(m.GetCount(), 10))
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("prometheus.encode: %w", err)
+	}
+	return nil
+}
+
+// writeSample writes a single sample line with sanitized labels. The extra label (le or quantile)
+// is appended after the series labels if extraName is not empty.
+func writeSample(w *bufio.Writer, name string, labels map[string]string, extraName, extraValue, value string) {
+	w.WriteString(name)
+
+	names := make([]string, 0, len(labels))
+	for n := range labels {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	if len(names) > 0 || extraName != "" {
+		w.WriteByte('{')
+		for i, n := range names {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			writeLabel(w, n, labels[n])
+		}
+		if extraName != "" {
+			if len(names) > 0 {
+				w.WriteByte(',')
+			}
+			writeLabel(w, extraName, extraValue)
+		}
+		w.WriteByte('}')
+	}
+
+	w.WriteByte(' ')
+	w.WriteString(value)
+	w.WriteByte('\n')
+}
+
+func writeLabel(w *bufio.Writer, name, value string) {
+	w.WriteString(name)
+	w.WriteString(`="`)
+	w.WriteString(labelValueEscaper.Replace(value))
+	w.WriteByte('"')
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// sanitizeName replaces characters that are not allowed in Prometheus metric and label names with underscores.
+func sanitizeName(name string) string {
+	if name == "" {
+		return "_"
+	}
+
+	var sb strings.Builder
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == ':':
+			sb.WriteRune(r)
+		case r >= '0' && r <= '9' && i > 0:
+			sb.WriteRune(r)
+		default:
+			sb.WriteByte('_')
+		}
+	}
+	return sb.String()
+}
+
+// sanitizeLabels returns the labels with sanitized names. Of the labels sharing a sanitized name
+// the one with the lowest original name is kept.
+func sanitizeLabels(labels map[string]string) map[string]string {
+	if len(labels) == 0 {
+		return labels
+	}
+
+	names := make([]string, 0, len(labels))
+	for n := range labels {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	res := make(map[string]string, len(labels))
+	for _, n := range names {
+		sanitized := sanitizeLabelName(n)
+		if _, exists := res[sanitized]; !exists {
+			res[sanitized] = labels[n]
+		}
+	}
+	return res
+}
+
+// sanitizeLabelName is like sanitizeName, but also replaces colons, which are reserved in label names.
+func sanitizeLabelName(name string) string {
+	return strings.ReplaceAll(sanitizeName(name), ":", "_")
+}
+
+func formatFloat(val float64) string {
+	switch {
+	case math.IsInf(val, 1):
+		return "+Inf"
+	case math.IsInf(val, -1):
+		return "-Inf"
+	case math.IsNaN(val):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(val, 'g', -1, 64)
+	}
+}
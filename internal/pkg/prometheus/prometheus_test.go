@@ -0,0 +1,141 @@
+package prometheus
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+)
+
+func TestEncode(t *testing.T) {
+	labeledGauge := metrics.NewGaugeMetric("Alloc", 2.5)
+	labeledGauge.Labels = map[string]string{"host": `a"b`, "dc": "eu"}
+
+	histogram := metrics.NewHistogramMetric("request.latency", []float64{0.1, 1})
+	histogram.Observe(0.5)
+
+	appRequestsGauge := metrics.NewGaugeMetric("app.requests", 5)
+	appRequestsGauge.Labels = map[string]string{"host": "b"}
+	labeledRequests := metrics.NewCounterMetric("app_requests", 3)
+	labeledRequests.Labels = map[string]string{"host": "a"}
+
+	tests := []struct {
+		name     string
+		metrics  []metrics.Metric
+		expected string
+	}{
+		{
+			name:     "Counter and gauge",
+			metrics:  []metrics.Metric{metrics.NewGaugeMetric("Alloc", 1), metrics.NewCounterMetric("PollCount", 7)},
+			expected: "# TYPE Alloc gauge\nAlloc 1\n# TYPE PollCount counter\nPollCount 7\n",
+		},
+		{
+			name:    "Series of one family share the type line",
+			metrics: []metrics.Metric{labeledGauge, metrics.NewGaugeMetric("Alloc", 1)},
+			expected: "# TYPE Alloc gauge\n" +
+				"Alloc 1\n" +
+				"Alloc{dc=\"eu\",host=\"a\\\"b\"} 2.5\n",
+		},
+		{
+			name:    "Histogram",
+			metrics: []metrics.Metric{histogram},
+			expected: "# TYPE request_latency histogram\n" +
+				"request_latency_bucket{le=\"0.1\"} 0\n" +
+				"request_latency_bucket{le=\"1\"} 1\n" +
+				"request_latency_bucket{le=\"+Inf\"} 1\n" +
+				"request_latency_sum 0.5\n" +
+				"request_latency_count 1\n",
+		},
+		{
+			name:    "Summary",
+			metrics: []metrics.Metric{metrics.NewSummaryMetric("size", []metrics.Quantile{{Quantile: 0.5, Value: 3}}, 10, 4)},
+			expected: "# TYPE size summary\n" +
+				"size{quantile=\"0.5\"} 3\n" +
+				"size_sum 10\n" +
+				"size_count 4\n",
+		},
+		{
+			name: "IDs with the same sanitized name share a family",
+			metrics: []metrics.Metric{
+				metrics.NewCounterMetric("app_requests", 2),
+				metrics.NewCounterMetric("app.requests", 1),
+				appRequestsGauge,
+				labeledRequests,
+			},
+			expected: "# TYPE app_requests counter\n" +
+				"app_requests 1\n" +
+				"app_requests{host=\"a\"} 3\n",
+		},
+		{
+			name: "Families named like histogram and summary samples are skipped",
+			metrics: []metrics.Metric{
+				metrics.NewGaugeMetric("request.latency_count", 1),
+				histogram,
+				metrics.NewCounterMetric("request_latency_bucket", 2),
+				metrics.NewSummaryMetric("size", []metrics.Quantile{{Quantile: 0.5, Value: 3}}, 10, 4),
+				metrics.NewGaugeMetric("size_sum", 1),
+				metrics.NewGaugeMetric("size_total", 2),
+			},
+			expected: "# TYPE request_latency histogram\n" +
+				"request_latency_bucket{le=\"0.1\"} 0\n" +
+				"request_latency_bucket{le=\"1\"} 1\n" +
+				"request_latency_bucket{le=\"+Inf\"} 1\n" +
+				"request_latency_sum 0.5\n" +
+				"request_latency_count 1\n" +
+				"# TYPE size summary\n" +
+				"size{quantile=\"0.5\"} 3\n" +
+				"size_sum 10\n" +
+				"size_count 4\n" +
+				"# TYPE size_total gauge\n" +
+				"size_total 2\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := Encode(&buf, test.metrics)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, buf.String())
+		})
+	}
+}
+
+func TestDecode(t *testing.T) {
+	text := `# HELP http_requests_total Requests served.
+# TYPE http_requests_total counter
+http_requests_total{method="GET",path="/a\"b"} 1027 1395066363000
+http_requests_total{method="POST"} 3
+# TYPE temperature gauge
+temperature -1.5e1
+# TYPE latency histogram
+latency_bucket{le="0.5"} 2
+latency_bucket{le="+Inf"} 3
+latency_sum 1.2
+latency_count 3
+# TYPE rpc summary
+rpc{quantile="0.9"} NaN
+rpc_count 0
+up 1
+`
+
+	samples, err := Decode(strings.NewReader(text))
+	require.NoError(t, err)
+	require.Len(t, samples, 10)
+
+	assert.Equal(t, Sample{Name: "http_requests_total", Type: TypeCounter, Labels: map[string]string{"method": "GET", "path": `/a"b`}, Value: 1027}, samples[0])
+	assert.Equal(t, Sample{Name: "temperature", Type: TypeGauge, Value: -15}, samples[2])
+	assert.Equal(t, Sample{Name: "latency_bucket", Type: TypeHistogram, Labels: map[string]string{"le": "+Inf"}, Value: 3}, samples[4])
+	assert.Equal(t, TypeHistogram, samples[6].Type)
+	assert.True(t, math.IsNaN(samples[7].Value))
+	assert.Equal(t, TypeSummary, samples[8].Type)
+	assert.Equal(t, Sample{Name: "up", Type: TypeUntyped, Value: 1}, samples[9])
+
+	for _, invalid := range []string{"up", `up{job="a} 1`, "up one", `up{job=a} 1`} {
+		_, err := Decode(strings.NewReader(invalid))
+		assert.Error(t, err, invalid)
+	}
+}
@@ -0,0 +1,61 @@
+// Package protoconv converts metrics between their internal representation
+// and the protobuf messages used by the gRPC API.
+package protoconv
+
+import (
+	"fmt"
+
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+	"github.com/ulixes-bloom/ya-metrics/proto"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+// ToProto converts a metric to the protobuf Metric message.
+func ToProto(m metrics.Metric) *proto.Metric {
+	pbMetric := &proto.Metric{
+		Id:     m.ID,
+		Mtype:  m.MType,
+		Value:  m.Value,
+		Delta:  m.Delta,
+		Labels: m.Labels,
+		Count:  m.Count,
+		Sum:    m.Sum,
+	}
+	for _, b := range m.Buckets {
+		pbMetric.Buckets = append(pbMetric.Buckets, &proto.Bucket{UpperBound: b.UpperBound, Count: b.Count})
+	}
+	for _, q := range m.Quantiles {
+		pbMetric.Quantiles = append(pbMetric.Quantiles, &proto.Quantile{Quantile: q.Quantile, Value: q.Value})
+	}
+	return pbMetric
+}
+
+// FromProto converts the protobuf Metric message to a metric.
+func FromProto(pbMetric *proto.Metric) metrics.Metric {
+	m := metrics.Metric{
+		ID:     pbMetric.GetId(),
+		MType:  pbMetric.GetMtype(),
+		Value:  pbMetric.Value,
+		Delta:  pbMetric.Delta,
+		Labels: pbMetric.GetLabels(),
+		Count:  pbMetric.Count,
+		Sum:    pbMetric.Sum,
+	}
+	for _, b := range pbMetric.GetBuckets() {
+		m.Buckets = append(m.Buckets, metrics.Bucket{UpperBound: b.GetUpperBound(), Count: b.GetCount()})
+	}
+	for _, q := range pbMetric.GetQuantiles() {
+		m.Quantiles = append(m.Quantiles, metrics.Quantile{Quantile: q.GetQuantile(), Value: q.GetValue()})
+	}
+	return m
+}
+
+// MarshalBatch deterministically encodes the metrics of a batch request.
+// The result is the data signed by the hash of UpdateMetricsRequest.
+func MarshalBatch(pbMetrics []*proto.Metric) ([]byte, error) {
+	data, err := protobuf.MarshalOptions{Deterministic: true}.Marshal(&proto.UpdateMetricsRequest{Metrics: pbMetrics})
+	if err != nil {
+		return nil, fmt.Errorf("protoconv.marshalBatch: %w", err)
+	}
+	return data, nil
+}
@@ -3,6 +3,7 @@
 package retry
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
@@ -33,10 +34,16 @@ func (e ErrorSlice) Error() string {
 	return fmt.Sprintf("Retry attempts failed: %s", strings.Join(logWithNumber, "|"))
 }
 
+// Unwrap returns the errors of the attempts, so they can be inspected with errors.Is and errors.As.
+func (e ErrorSlice) Unwrap() []error {
+	return e
+}
+
 // Do performs the given retryable function with the specified retry logic.
-// It retries the operation up to the specified number of attempts if the error returned
-// from the retryable function satisfies the shouldRetry function.
-func Do(retryableFunc RetryableFunc, shouldRetryFunc ShouldRetryFunc, attempts uint) error {
+// It calls the function up to the specified number of attempts while the returned error
+// satisfies the shouldRetry function and returns nil as soon as an attempt succeeds.
+// Waiting for the next attempt is interrupted when the context is done.
+func Do(ctx context.Context, retryableFunc RetryableFunc, shouldRetryFunc ShouldRetryFunc, attempts uint) error {
 	err := retryableFunc()
 	if err == nil {
 		return nil
@@ -50,18 +57,25 @@ func Do(retryableFunc RetryableFunc, shouldRetryFunc ShouldRetryFunc, attempts u
 	attemptTimeout := nextAttemptTimeout(nil)
 	curAttempt := uint(2)
 
-	for shouldRetry && curAttempt != attempts {
-		time.Sleep(attemptTimeout)
+	for shouldRetry && curAttempt <= attempts {
+		timer := time.NewTimer(attemptTimeout)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return append(errorSlice, ctx.Err())
+		case <-timer.C:
+		}
 
 		err = retryableFunc()
-		if err != nil {
-			errorSlice = append(errorSlice, err)
+		if err == nil {
+			return nil
+		}
+		errorSlice = append(errorSlice, err)
 
-			if shouldRetryFunc(err) {
-				attemptTimeout = nextAttemptTimeout(&attemptTimeout)
-			} else {
-				shouldRetry = false
-			}
+		if shouldRetryFunc(err) {
+			attemptTimeout = nextAttemptTimeout(&attemptTimeout)
+		} else {
+			shouldRetry = false
 		}
 
 		curAttempt++
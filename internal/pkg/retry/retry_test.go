@@ -0,0 +1,85 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	errRetryable = errors.New("retryable")
+	errFatal     = errors.New("fatal")
+)
+
+func TestDo(t *testing.T) {
+	tests := []struct {
+		name      string
+		results   []error // results of the attempts in order, nil on success
+		attempts  uint
+		wantErr   error
+		wantCalls int
+	}{
+		{
+			name:      "Success on the first attempt",
+			results:   []error{nil},
+			attempts:  3,
+			wantCalls: 1,
+		},
+		{
+			name:      "Success on a retry",
+			results:   []error{errRetryable, nil},
+			attempts:  3,
+			wantCalls: 2,
+		},
+		{
+			name:      "Attempts exhausted",
+			results:   []error{errRetryable, errRetryable, nil},
+			attempts:  2,
+			wantErr:   errRetryable,
+			wantCalls: 2,
+		},
+		{
+			name:      "Error not to retry",
+			results:   []error{errFatal, nil},
+			attempts:  3,
+			wantErr:   errFatal,
+			wantCalls: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			calls := 0
+			err := Do(context.Background(), func() error {
+				calls++
+				return test.results[calls-1]
+			}, func(err error) bool { return errors.Is(err, errRetryable) }, test.attempts)
+
+			assert.Equal(t, test.wantCalls, calls)
+			if test.wantErr == nil {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, test.wantErr)
+		})
+	}
+}
+
+func TestDoContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	calls := 0
+	err := Do(ctx, func() error {
+		calls++
+		return errRetryable
+	}, func(err error) bool { return true }, 3)
+
+	assert.Equal(t, 1, calls)
+	require.ErrorIs(t, err, context.Canceled)
+	require.ErrorIs(t, err, errRetryable)
+}
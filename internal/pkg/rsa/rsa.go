@@ -11,7 +11,11 @@ import (
 	"os"
 )
 
-// Encrypt encrypts plaintext using public key cpecified in publicKeyPath
+// pkcs1v15Overhead is the number of bytes taken by PKCS #1 v1.5 padding in every encrypted block.
+const pkcs1v15Overhead = 11
+
+// Encrypt encrypts plaintext using public key cpecified in publicKeyPath.
+// Plaintext longer than the key allows is split and encrypted in several blocks.
 func Encrypt(plaintext []byte, publicKeyPath string) ([]byte, error) {
 	publicKeyPem, err := os.ReadFile(publicKeyPath)
 	if err != nil {
@@ -23,15 +27,24 @@ func Encrypt(plaintext []byte, publicKeyPath string) ([]byte, error) {
 		return nil, fmt.Errorf("cipher.encrypt.parsePublicKey '%s': %w", publicKeyPath, err)
 	}
 
-	ciphertext, err := rsa.EncryptPKCS1v15(rand.Reader, publicKey.(*rsa.PublicKey), plaintext)
-	if err != nil {
-		return nil, fmt.Errorf("cipher.encrypt: %w", err)
+	// plaintexts longer than a single block are encrypted block by block
+	rsaKey := publicKey.(*rsa.PublicKey)
+	blockSize := rsaKey.Size() - pkcs1v15Overhead
+	var ciphertext []byte
+	for start := 0; start < len(plaintext) || start == 0; start += blockSize {
+		end := min(start+blockSize, len(plaintext))
+		block, err := rsa.EncryptPKCS1v15(rand.Reader, rsaKey, plaintext[start:end])
+		if err != nil {
+			return nil, fmt.Errorf("cipher.encrypt: %w", err)
+		}
+		ciphertext = append(ciphertext, block...)
 	}
 
 	return ciphertext, nil
 }
 
-// Decrypt decrypts ciphertest using private key cpecified in privateKeyPath
+// Decrypt decrypts ciphertest using private key cpecified in privateKeyPath.
+// Ciphertext may consist of several blocks produced by Encrypt.
 func Decrypt(ciphertext []byte, privateKeyPath string) ([]byte, error) {
 	privateKeyPEM, err := os.ReadFile(privateKeyPath)
 	if err != nil {
@@ -43,9 +56,18 @@ func Decrypt(ciphertext []byte, privateKeyPath string) ([]byte, error) {
 		return nil, fmt.Errorf("cipher.decrypt.parsePrivateKey '%s': %w", privateKeyPath, err)
 	}
 
-	plaintext, err := rsa.DecryptPKCS1v15(rand.Reader, privateKey, ciphertext)
-	if err != nil {
-		return nil, fmt.Errorf("cipher.decrypt: %w", err)
+	// ciphertext consists of one or more blocks of the key size
+	blockSize := privateKey.Size()
+	if len(ciphertext) == 0 || len(ciphertext)%blockSize != 0 {
+		return nil, fmt.Errorf("cipher.decrypt: ciphertext length %d is not a multiple of the key size", len(ciphertext))
+	}
+	var plaintext []byte
+	for start := 0; start < len(ciphertext); start += blockSize {
+		block, err := rsa.DecryptPKCS1v15(rand.Reader, privateKey, ciphertext[start:start+blockSize])
+		if err != nil {
+			return nil, fmt.Errorf("cipher.decrypt: %w", err)
+		}
+		plaintext = append(plaintext, block...)
 	}
 
 	return plaintext, nil
@@ -0,0 +1,209 @@
+// Package alerting evaluates alerting rules against the stored metrics
+// and keeps track of the state of the resulting alerts.
+//
+// Every series matching a rule gets its own alert. An alert is pending while the rule
+// condition holds for less than the rule duration, firing afterwards and resolved
+// once the condition stops holding.
+package alerting
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+	"github.com/ulixes-bloom/ya-metrics/internal/server/config"
+)
+
+// Alert states.
+const (
+	StatePending  = "pending"
+	StateFiring   = "firing"
+	StateResolved = "resolved"
+)
+
+// resolvedRetention is how long resolved alerts are still reported.
+const resolvedRetention = 15 * time.Minute
+
+// Alert is the state of a single rule for a single series.
+type Alert struct {
+	Rule       string            `json:"rule"`                  // Name of the rule
+	Metric     string            `json:"metric"`                // ID of the series
+	Labels     map[string]string `json:"labels,omitempty"`      // Labels of the series and the rule
+	State      string            `json:"state"`                 // "pending", "firing" or "resolved"
+	Value      float64           `json:"value"`                 // Value of the series at the latest evaluation
+	ActiveAt   time.Time         `json:"active_at"`             // Time the condition started to hold
+	FiredAt    *time.Time        `json:"fired_at,omitempty"`    // Time the alert started firing (optional)
+	ResolvedAt *time.Time        `json:"resolved_at,omitempty"` // Time the alert was resolved (optional)
+}
+
+type engine struct {
+	rules    []rule
+	storage  Storage
+	notifier Notifier
+	alerts   map[string]*Alert // alerts by rule name and series key
+	conf     *config.Config
+	mutex    sync.RWMutex
+}
+
+// New parses the rules from conf.AlertRules and creates an engine evaluating them against the storage.
+// After every evaluation the current alerts are passed to the notifier, which may be nil.
+func New(conf *config.Config, storage Storage, notifier Notifier) (*engine, error) {
+	e := engine{
+		storage:  storage,
+		notifier: notifier,
+		alerts:   make(map[string]*Alert),
+		conf:     conf,
+	}
+
+	names := make(map[string]bool, len(conf.AlertRules))
+	for _, r := range conf.AlertRules {
+		parsed, err := parseRule(r)
+		if err != nil {
+			return nil, fmt.Errorf("alerting.new: %w", err)
+		}
+		if names[parsed.name] {
+			return nil, fmt.Errorf("alerting.new: duplicate rule name '%s'", parsed.name)
+		}
+		names[parsed.name] = true
+		e.rules = append(e.rules, parsed)
+	}
+
+	return &e, nil
+}
+
+// Run evaluates the rules with the period specified in config.AlertInterval until the context is done.
+func (e *engine) Run(ctx context.Context) {
+	if len(e.rules) == 0 {
+		return
+	}
+
+	evalTicker := time.NewTicker(e.conf.GetAlertIntervalDuration())
+	defer evalTicker.Stop()
+
+	for {
+		select {
+		case now := <-evalTicker.C:
+			if err := e.Evaluate(ctx, now); err != nil {
+				log.Error().Msg(err.Error())
+			}
+		case <-ctx.Done():
+			log.Debug().Msg("done evaluating alerting rules")
+			return
+		}
+	}
+}
+
+// Evaluate checks every rule against the current metrics, updates the state of alerts
+// and passes them to the notifier.
+func (e *engine) Evaluate(ctx context.Context, now time.Time) error {
+	allMetrics, err := e.storage.GetAll(ctx)
+	if err != nil {
+		return fmt.Errorf("alerting.evaluate: %w", err)
+	}
+
+	e.update(allMetrics, now)
+
+	if e.notifier != nil {
+		if err := e.notifier.Notify(ctx, now, e.GetAlerts()); err != nil {
+			return fmt.Errorf("alerting.evaluate: %w", err)
+		}
+	}
+	return nil
+}
+
+// update moves alerts between states according to the rule conditions on the given metrics.
+func (e *engine) update(allMetrics []metrics.Metric, now time.Time) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	active := make(map[string]bool)
+	for _, r := range e.rules {
+		for _, m := range allMetrics {
+			if !r.matches(m) {
+				continue
+			}
+			val := m.SampleValue()
+			if !r.holds(val) {
+				continue
+			}
+
+			key := r.name + "/" + m.Key()
+			active[key] = true
+
+			a, exists := e.alerts[key]
+			if !exists || a.State == StateResolved {
+				a = &Alert{
+					Rule:     r.name,
+					Metric:   m.ID,
+					Labels:   mergeLabels(m.Labels, r.labels),
+					State:    StatePending,
+					ActiveAt: now,
+				}
+				e.alerts[key] = a
+			}
+			a.Value = val
+
+			if a.State == StatePending && now.Sub(a.ActiveAt) >= r.duration {
+				firedAt := now
+				a.State = StateFiring
+				a.FiredAt = &firedAt
+			}
+		}
+	}
+
+	for key, a := range e.alerts {
+		if active[key] {
+			continue
+		}
+		switch a.State {
+		case StatePending:
+			delete(e.alerts, key)
+		case StateFiring:
+			resolvedAt := now
+			a.State = StateResolved
+			a.ResolvedAt = &resolvedAt
+		case StateResolved:
+			if now.Sub(*a.ResolvedAt) > resolvedRetention {
+				delete(e.alerts, key)
+			}
+		}
+	}
+}
+
+// GetAlerts returns the current alerts ordered by rule name and series.
+func (e *engine) GetAlerts() []Alert {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	keys := make([]string, 0, len(e.alerts))
+	for key := range e.alerts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	res := make([]Alert, 0, len(keys))
+	for _, key := range keys {
+		res = append(res, *e.alerts[key])
+	}
+	return res
+}
+
+// mergeLabels returns the union of series and rule labels, rule labels take precedence.
+func mergeLabels(seriesLabels, ruleLabels map[string]string) map[string]string {
+	if len(seriesLabels) == 0 && len(ruleLabels) == 0 {
+		return nil
+	}
+
+	labels := make(map[string]string, len(seriesLabels)+len(ruleLabels))
+	for name, val := range seriesLabels {
+		labels[name] = val
+	}
+	for name, val := range ruleLabels {
+		labels[name] = val
+	}
+	return labels
+}
@@ -0,0 +1,101 @@
+package alerting
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+	"github.com/ulixes-bloom/ya-metrics/internal/server/config"
+)
+
+type staticStorage struct {
+	metrics []metrics.Metric
+}
+
+func (s *staticStorage) GetAll(ctx context.Context) ([]metrics.Metric, error) {
+	return s.metrics, nil
+}
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		want    rule
+		wantErr bool
+	}{
+		{
+			name: "Simple comparison",
+			expr: "CPUutilization1 > 90",
+			want: rule{name: "test", metric: "CPUutilization1", op: ">", threshold: 90},
+		},
+		{
+			name: "Comparison with labels and duration",
+			expr: `CPUutilization1{host="a", dc="b"} >= 90.5 for 5m`,
+			want: rule{
+				name:      "test",
+				metric:    "CPUutilization1",
+				matchers:  map[string]string{"host": "a", "dc": "b"},
+				op:        ">=",
+				threshold: 90.5,
+				duration:  5 * time.Minute,
+			},
+		},
+		{name: "Unknown operator", expr: "CPUutilization1 => 90", wantErr: true},
+		{name: "Invalid threshold", expr: "CPUutilization1 > high", wantErr: true},
+		{name: "Invalid duration", expr: "CPUutilization1 > 90 for ever", wantErr: true},
+		{name: "Invalid label matcher", expr: "CPUutilization1{host=a} > 90", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseRule(config.AlertRule{Name: "test", Expr: test.expr})
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	ctx := context.Background()
+	conf := config.GetDefault()
+	conf.AlertRules = []config.AlertRule{
+		{Name: "HighCPU", Expr: "CPUutilization1 > 90 for 1m"},
+	}
+	storage := &staticStorage{}
+	e, err := New(conf, storage, nil)
+	require.NoError(t, err)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	steps := []struct {
+		offset time.Duration
+		value  float64
+		state  string // expected state, empty if no alert is expected
+	}{
+		{offset: 0, value: 95, state: StatePending},
+		{offset: 30 * time.Second, value: 50},
+		{offset: time.Minute, value: 95, state: StatePending},
+		{offset: 2 * time.Minute, value: 97, state: StateFiring},
+		{offset: 3 * time.Minute, value: 10, state: StateResolved},
+		{offset: 3*time.Minute + resolvedRetention + time.Second, value: 10},
+	}
+
+	for _, step := range steps {
+		storage.metrics = []metrics.Metric{metrics.NewGaugeMetric("CPUutilization1", step.value)}
+		require.NoError(t, e.Evaluate(ctx, start.Add(step.offset)))
+
+		alerts := e.GetAlerts()
+		if step.state == "" {
+			assert.Empty(t, alerts, "offset %s", step.offset)
+			continue
+		}
+		require.Len(t, alerts, 1, "offset %s", step.offset)
+		assert.Equal(t, step.state, alerts[0].State, "offset %s", step.offset)
+	}
+}
@@ -0,0 +1,18 @@
+package alerting
+
+import (
+	"context"
+	"time"
+
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+)
+
+type (
+	Storage interface {
+		GetAll(ctx context.Context) ([]metrics.Metric, error)
+	}
+
+	Notifier interface {
+		Notify(ctx context.Context, now time.Time, alerts []Alert) error
+	}
+)
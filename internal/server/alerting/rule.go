@@ -0,0 +1,106 @@
+package alerting
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+	"github.com/ulixes-bloom/ya-metrics/internal/server/config"
+)
+
+var (
+	exprRegexp  = regexp.MustCompile(`^\s*([A-Za-z_:][\w:.\-]*)\s*(?:\{([^}]*)\})?\s*(>=|<=|==|!=|>|<)\s*(\S+)\s*(?:for\s+(\S+))?\s*$`)
+	labelRegexp = regexp.MustCompile(`^\s*([A-Za-z_]\w*)\s*=\s*"([^"]*)"\s*$`)
+)
+
+// rule is a parsed alerting rule.
+type rule struct {
+	name      string
+	metric    string            // ID of the checked series
+	matchers  map[string]string // labels the checked series must have
+	op        string            // comparison operator
+	threshold float64
+	duration  time.Duration // how long the condition must hold before the alert fires
+	labels    map[string]string
+}
+
+// parseRule parses the expression of the rule, e.g. `CPUutilization1{host="a"} > 90 for 5m`.
+func parseRule(r config.AlertRule) (rule, error) {
+	if r.Name == "" {
+		return rule{}, fmt.Errorf("alerting.parseRule: rule without name")
+	}
+
+	match := exprRegexp.FindStringSubmatch(r.Expr)
+	if match == nil {
+		return rule{}, fmt.Errorf("alerting.parseRule: '%s': invalid expression '%s'", r.Name, r.Expr)
+	}
+
+	parsed := rule{
+		name:   r.Name,
+		metric: match[1],
+		op:     match[3],
+		labels: r.Labels,
+	}
+
+	if match[2] != "" {
+		parsed.matchers = make(map[string]string)
+		for _, pair := range strings.Split(match[2], ",") {
+			label := labelRegexp.FindStringSubmatch(pair)
+			if label == nil {
+				return rule{}, fmt.Errorf("alerting.parseRule: '%s': invalid label matcher '%s'", r.Name, pair)
+			}
+			parsed.matchers[label[1]] = label[2]
+		}
+	}
+
+	threshold, err := strconv.ParseFloat(match[4], 64)
+	if err != nil {
+		return rule{}, fmt.Errorf("alerting.parseRule: '%s': invalid threshold '%s'", r.Name, match[4])
+	}
+	parsed.threshold = threshold
+
+	if match[5] != "" {
+		parsed.duration, err = time.ParseDuration(match[5])
+		if err != nil || parsed.duration < 0 {
+			return rule{}, fmt.Errorf("alerting.parseRule: '%s': invalid duration '%s'", r.Name, match[5])
+		}
+	}
+
+	return parsed, nil
+}
+
+// matches reports whether the rule checks the series of the metric.
+func (r *rule) matches(m metrics.Metric) bool {
+	if m.ID != r.metric {
+		return false
+	}
+	for name, val := range r.matchers {
+		if m.Labels[name] != val {
+			return false
+		}
+	}
+	return true
+}
+
+// holds reports whether the value satisfies the rule condition.
+func (r *rule) holds(val float64) bool {
+	switch r.op {
+	case ">":
+		return val > r.threshold
+	case ">=":
+		return val >= r.threshold
+	case "<":
+		return val < r.threshold
+	case "<=":
+		return val <= r.threshold
+	case "==":
+		return val == r.threshold
+	case "!=":
+		return val != r.threshold
+	default:
+		return false
+	}
+}
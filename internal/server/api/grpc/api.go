@@ -3,10 +3,16 @@ package grpcapi
 import (
 	"context"
 	"crypto/tls"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"sort"
 
+	appErrors "github.com/ulixes-bloom/ya-metrics/internal/pkg/errors"
 	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/protoconv"
 	"github.com/ulixes-bloom/ya-metrics/internal/server/api"
 	"github.com/ulixes-bloom/ya-metrics/internal/server/api/grpc/interceptor"
 	"github.com/ulixes-bloom/ya-metrics/internal/server/config"
@@ -15,10 +21,16 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
 )
 
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
 type grpcAPI struct {
 	proto.UnimplementedMonitoringServer
 
@@ -27,20 +39,146 @@ type grpcAPI struct {
 }
 
 func (g *grpcAPI) UpdateMetric(ctx context.Context, in *proto.UpdateMetricRequest) (*emptypb.Empty, error) {
-	metric, err := metrics.NewMetric(in.Metric.Id, in.Metric.Mtype, in.Metric.GetValue(), in.Metric.GetDelta())
+	metric := protoconv.FromProto(in.GetMetric())
+
+	if _, err := g.service.UpdateJSONMetric(ctx, metric); err != nil {
+		return nil, updateError(err)
+	}
+
+	return nil, nil
+}
+
+// UpdateMetrics receives metrics from the client stream and stores them as a single batch
+// once the client closes the stream.
+func (g *grpcAPI) UpdateMetrics(stream proto.Monitoring_UpdateMetricsServer) error {
+	var batch []metrics.Metric
+	for {
+		in, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		batch = append(batch, protoconv.FromProto(in.GetMetric()))
+	}
+
+	if err := g.service.UpdateMetrics(stream.Context(), batch); err != nil {
+		return updateError(err)
+	}
+
+	return stream.SendAndClose(&emptypb.Empty{})
+}
+
+// UpdateMetricsBatch stores all metrics of the request as a single batch.
+func (g *grpcAPI) UpdateMetricsBatch(ctx context.Context, in *proto.UpdateMetricsRequest) (*emptypb.Empty, error) {
+	batch := make([]metrics.Metric, 0, len(in.GetMetrics()))
+	for _, m := range in.GetMetrics() {
+		batch = append(batch, protoconv.FromProto(m))
+	}
+
+	if err := g.service.UpdateMetrics(ctx, batch); err != nil {
+		return nil, updateError(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// GetMetric returns the stored metric of the series. If the type is set in the request,
+// the metric must be of this type.
+func (g *grpcAPI) GetMetric(ctx context.Context, in *proto.GetMetricRequest) (*proto.Metric, error) {
+	m, err := g.service.FindMetric(ctx, in.GetId(), in.GetLabels())
 	if err != nil {
+		if errors.Is(err, appErrors.ErrMetricNotExists) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
 		return nil, status.Error(codes.Unknown, err.Error())
 	}
+	if in.GetMtype() != "" && in.GetMtype() != m.MType {
+		return nil, status.Error(codes.NotFound, appErrors.ErrMetricNotExists.Error())
+	}
+
+	return protoconv.ToProto(m), nil
+}
+
+// ListMetrics returns a page of metrics matching the filters of the request ordered by series key.
+// The next page is requested with the page token returned in the response.
+func (g *grpcAPI) ListMetrics(ctx context.Context, in *proto.ListMetricsRequest) (*proto.ListMetricsResponse, error) {
+	pageSize := int(in.GetPageSize())
+	switch {
+	case pageSize < 0:
+		return nil, status.Error(codes.InvalidArgument, "negative page size")
+	case pageSize == 0:
+		pageSize = defaultPageSize
+	case pageSize > maxPageSize:
+		pageSize = maxPageSize
+	}
+
+	// the page token is the encoded key of the last series of the previous page
+	var after string
+	if in.GetPageToken() != "" {
+		key, err := base64.RawURLEncoding.DecodeString(in.GetPageToken())
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid page token")
+		}
+		after = string(key)
+	}
 
-	if _, err = g.service.UpdateJSONMetric(ctx, metric); err != nil {
+	list, err := g.service.ListMetrics(ctx, in.GetIdPrefix(), in.GetMtype())
+	if err != nil {
 		return nil, status.Error(codes.Unknown, err.Error())
 	}
 
-	return nil, nil
+	start := 0
+	if after != "" {
+		start = sort.Search(len(list), func(i int) bool { return list[i].Key() > after })
+	}
+	end := min(start+pageSize, len(list))
+
+	var res proto.ListMetricsResponse
+	for _, m := range list[start:end] {
+		res.Metrics = append(res.Metrics, protoconv.ToProto(m))
+	}
+	if end < len(list) {
+		res.NextPageToken = base64.RawURLEncoding.EncodeToString([]byte(list[end-1].Key()))
+	}
+	return &res, nil
+}
+
+// WatchMetrics streams metrics matching the filters of the request as they are written to the storage
+// until the client cancels the call.
+func (g *grpcAPI) WatchMetrics(in *proto.WatchMetricsRequest, stream proto.Monitoring_WatchMetricsServer) error {
+	updates, err := g.service.WatchMetrics(stream.Context(), in.GetIdPrefix(), in.GetMtype())
+	if err != nil {
+		if errors.Is(err, appErrors.ErrWatchNotSupported) {
+			return status.Error(codes.Unimplemented, err.Error())
+		}
+		return status.Error(codes.Unknown, err.Error())
+	}
+	// let the client know the subscription is active before the first update
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	for m := range updates {
+		if err := stream.Send(protoconv.ToProto(m)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateError converts a failed update to a status error,
+// FailedPrecondition if a metric does not match the type of its stored series.
+func updateError(err error) error {
+	if errors.Is(err, appErrors.ErrMetricTypeMismatch) {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return status.Error(codes.Unknown, err.Error())
 }
 
 func New(conf *config.Config, storage service.Storage) *grpcAPI {
-	srv := service.New(storage, conf)
+	srv := service.New(storage, conf, nil)
 	newAPI := grpcAPI{
 		service: srv,
 		conf:    conf,
@@ -56,29 +194,53 @@ func (g *grpcAPI) Run(ctx context.Context) error {
 		return err
 	}
 
+	s, err := g.newServer()
+	if err != nil {
+		return fmt.Errorf("grpcapi.run: %w", err)
+	}
+
+	go func() {
+		errChan <- s.Serve(listen)
+	}()
+
+	select {
+	case err := <-errChan:
+		return fmt.Errorf("grpcapi.run: %w", err)
+	case <-ctx.Done():
+		return g.service.Shutdown(ctx)
+	}
+}
+
+// newServer creates a grpc server with the Monitoring Server implementation
+// and interceptors enabled by the config.
+func (g *grpcAPI) newServer() (*grpc.Server, error) {
 	var opts []grpc.ServerOption
 
 	// Chain interceptors
 	var interceptors []grpc.UnaryServerInterceptor
+	var streamInterceptors []grpc.StreamServerInterceptor
 	interceptors = append(interceptors, interceptor.WithLogging)
+	streamInterceptors = append(streamInterceptors, interceptor.WithStreamLogging)
 
 	// Add IP Resolving interceptor if the Trusted Subnet is set
 	if g.conf.TrustedSubnet != "" {
 		interceptors = append(interceptors, interceptor.WithIPResolving(g.conf.TrustedSubnet))
+		streamInterceptors = append(streamInterceptors, interceptor.WithStreamIPResolving(g.conf.TrustedSubnet))
 	}
 
 	// Add Hashing interceptor if the HashKey is set
 	if g.conf.HashKey != "" {
 		interceptors = append(interceptors, interceptor.WithHashing(g.conf.HashKey))
+		streamInterceptors = append(streamInterceptors, interceptor.WithStreamHashing(g.conf.HashKey))
 	}
 
-	opts = append(opts, grpc.ChainUnaryInterceptor(interceptors...))
+	opts = append(opts, grpc.ChainUnaryInterceptor(interceptors...), grpc.ChainStreamInterceptor(streamInterceptors...))
 
 	// configure TLS
 	if g.conf.PublicKey != "" && g.conf.PrivateKey != "" {
 		creds, err := g.loadTLSCredentials()
 		if err != nil {
-			return fmt.Errorf("grpcapi.run: %w", err)
+			return nil, fmt.Errorf("grpcapi.newServer: %w", err)
 		}
 
 		opts = append(opts, grpc.Creds(creds))
@@ -87,17 +249,7 @@ func (g *grpcAPI) Run(ctx context.Context) error {
 	// Create new grpc server and register Monitoring Server implementation
 	s := grpc.NewServer(opts...)
 	proto.RegisterMonitoringServer(s, g)
-
-	go func() {
-		errChan <- s.Serve(listen)
-	}()
-
-	select {
-	case err := <-errChan:
-		return fmt.Errorf("grpcapi.run: %w", err)
-	case <-ctx.Done():
-		return g.service.Shutdown(ctx)
-	}
+	return s, nil
 }
 
 // Load TLS credentials from PEM files
@@ -0,0 +1,199 @@
+package grpcapi
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/hash"
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/protoconv"
+	"github.com/ulixes-bloom/ya-metrics/internal/server/config"
+	"github.com/ulixes-bloom/ya-metrics/internal/server/service"
+	"github.com/ulixes-bloom/ya-metrics/internal/server/storage/memory"
+	"github.com/ulixes-bloom/ya-metrics/internal/server/watcher"
+	"github.com/ulixes-bloom/ya-metrics/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const contextTimeout = 30 * time.Second
+
+// newTestClient starts the grpc API over an in-memory connection and returns a client to it.
+func newTestClient(t *testing.T, conf *config.Config, storage service.Storage) proto.MonitoringClient {
+	s, err := New(conf, storage).newServer()
+	require.NoError(t, err)
+
+	listener := bufconn.Listen(1024 * 1024)
+	go s.Serve(listener)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return proto.NewMonitoringClient(conn)
+}
+
+func TestUpdateMetrics(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), contextTimeout)
+	defer cancel()
+
+	conf := config.GetDefault()
+	conf.HashKey = "secret"
+	ms, err := memory.NewStorage(ctx, conf)
+	require.NoError(t, err)
+	client := newTestClient(t, conf, ms)
+
+	// stream of signed metrics
+	stream, err := client.UpdateMetrics(ctx)
+	require.NoError(t, err)
+	for _, m := range []metrics.Metric{
+		metrics.NewCounterMetric("PollCount", 2),
+		metrics.NewCounterMetric("PollCount", 3),
+		metrics.NewGaugeMetric("Alloc", 1.5),
+	} {
+		pbMetric := protoconv.ToProto(m)
+		h, err := hash.Encode([]byte(pbMetric.String()), conf.HashKey)
+		require.NoError(t, err)
+		require.NoError(t, stream.Send(&proto.UpdateMetricRequest{Metric: pbMetric, Hash: &h}))
+	}
+	_, err = stream.CloseAndRecv()
+	require.NoError(t, err)
+
+	counter, err := ms.Get(ctx, "PollCount", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), *counter.Delta)
+
+	// signed batch
+	batch := []*proto.Metric{
+		protoconv.ToProto(metrics.NewGaugeMetric("Alloc", 2.5)),
+		protoconv.ToProto(metrics.NewGaugeMetric("HeapAlloc", 10)),
+	}
+	data, err := protoconv.MarshalBatch(batch)
+	require.NoError(t, err)
+	h, err := hash.Encode(data, conf.HashKey)
+	require.NoError(t, err)
+	_, err = client.UpdateMetricsBatch(ctx, &proto.UpdateMetricsRequest{Metrics: batch, Hash: &h})
+	require.NoError(t, err)
+
+	gauge, err := ms.Get(ctx, "Alloc", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2.5, *gauge.Value)
+
+	// batch with a wrong hash is rejected as a whole
+	batch = []*proto.Metric{protoconv.ToProto(metrics.NewGaugeMetric("Alloc", 100))}
+	wrongHash := "wrong"
+	_, err = client.UpdateMetricsBatch(ctx, &proto.UpdateMetricsRequest{Metrics: batch, Hash: &wrongHash})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	gauge, err = ms.Get(ctx, "Alloc", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2.5, *gauge.Value)
+
+	// counter of a gauge series
+	batch = []*proto.Metric{protoconv.ToProto(metrics.NewCounterMetric("Alloc", 1))}
+	data, err = protoconv.MarshalBatch(batch)
+	require.NoError(t, err)
+	h, err = hash.Encode(data, conf.HashKey)
+	require.NoError(t, err)
+	_, err = client.UpdateMetricsBatch(ctx, &proto.UpdateMetricsRequest{Metrics: batch, Hash: &h})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestReadMetrics(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), contextTimeout)
+	defer cancel()
+
+	conf := config.GetDefault()
+	ms, err := memory.NewStorage(ctx, conf)
+	require.NoError(t, err)
+	storage := watcher.New(ms)
+	client := newTestClient(t, conf, storage)
+
+	labeled := metrics.NewGaugeMetric("Alloc", 3)
+	labeled.Labels = map[string]string{"host": "a"}
+	_, err = storage.SetAll(ctx, []metrics.Metric{
+		metrics.NewGaugeMetric("Alloc", 1),
+		labeled,
+		metrics.NewGaugeMetric("HeapAlloc", 2),
+		metrics.NewCounterMetric("PollCount", 4),
+		metrics.NewGaugeMetric("AllocRate", 5),
+	})
+	require.NoError(t, err)
+
+	t.Run("Get metric", func(t *testing.T) {
+		m, err := client.GetMetric(ctx, &proto.GetMetricRequest{Id: "Alloc", Labels: map[string]string{"host": "a"}})
+		require.NoError(t, err)
+		assert.Equal(t, float64(3), m.GetValue())
+
+		_, err = client.GetMetric(ctx, &proto.GetMetricRequest{Id: "Alloc", Mtype: metrics.Counter})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+
+		_, err = client.GetMetric(ctx, &proto.GetMetricRequest{Id: "Unknown"})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	t.Run("List metrics by pages", func(t *testing.T) {
+		var ids []string
+		req := &proto.ListMetricsRequest{IdPrefix: "Alloc", Mtype: metrics.Gauge, PageSize: 2}
+		for pages := 0; ; pages++ {
+			require.Less(t, pages, 3)
+			resp, err := client.ListMetrics(ctx, req)
+			require.NoError(t, err)
+			for _, m := range resp.GetMetrics() {
+				ids = append(ids, metrics.SeriesKey(m.GetId(), m.GetLabels()))
+			}
+			if resp.GetNextPageToken() == "" {
+				break
+			}
+			req.PageToken = resp.GetNextPageToken()
+		}
+		assert.Equal(t, []string{"Alloc", "AllocRate", `Alloc{host="a"}`}, ids)
+	})
+
+	t.Run("Watch metrics", func(t *testing.T) {
+		watchCtx, watchCancel := context.WithCancel(ctx)
+		defer watchCancel()
+
+		stream, err := client.WatchMetrics(watchCtx, &proto.WatchMetricsRequest{Mtype: metrics.Counter})
+		require.NoError(t, err)
+		// the server sends headers once the stream is subscribed
+		_, err = stream.Header()
+		require.NoError(t, err)
+
+		_, err = storage.Set(ctx, metrics.NewGaugeMetric("Alloc", 10))
+		require.NoError(t, err)
+		_, err = storage.Set(ctx, metrics.NewCounterMetric("PollCount", 1))
+		require.NoError(t, err)
+
+		m, err := stream.Recv()
+		require.NoError(t, err)
+		assert.Equal(t, "PollCount", m.GetId())
+		assert.Equal(t, int64(5), m.GetDelta())
+
+		// a series updated several times within a batch is published once with its latest state
+		_, err = storage.SetAll(ctx, []metrics.Metric{
+			metrics.NewCounterMetric("PollCount", 1),
+			metrics.NewCounterMetric("PollCount", 2),
+			metrics.NewCounterMetric("Requests", 1),
+		})
+		require.NoError(t, err)
+
+		m, err = stream.Recv()
+		require.NoError(t, err)
+		assert.Equal(t, "PollCount", m.GetId())
+		assert.Equal(t, int64(8), m.GetDelta())
+		m, err = stream.Recv()
+		require.NoError(t, err)
+		assert.Equal(t, "Requests", m.GetId())
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/ulixes-bloom/ya-metrics/internal/pkg/hash"
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/protoconv"
 	"github.com/ulixes-bloom/ya-metrics/proto"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -12,6 +13,7 @@ import (
 
 // WithHashing is a gRPC server-side interceptor that checks the hash of the incoming request's data.
 // It compares the hash of the "Metric" in the request with the provided hash. If they do not match, the request is rejected.
+// Batch requests are checked by the hash of all their metrics, requests without metrics are not checked.
 func WithHashing(hashKey string) func(
 	ctx context.Context,
 	req any,
@@ -19,20 +21,65 @@ func WithHashing(hashKey string) func(
 	handler grpc.UnaryHandler,
 ) (any, error) {
 	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
-		updateMetricRequest, ok := req.(*proto.UpdateMetricRequest)
-		if !ok {
-			return nil, status.Error(codes.Internal, "Unable to parse updateMetricRequest")
+		if err := checkHash(req, hashKey); err != nil {
+			return nil, err
 		}
 
-		h, err := hash.Encode([]byte(updateMetricRequest.Metric.String()), hashKey)
+		return handler(ctx, req)
+	}
+}
+
+// WithStreamHashing is a gRPC server-side stream interceptor that checks the hash of every message received from the stream.
+func WithStreamHashing(hashKey string) func(
+	srv any,
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &hashingStream{ServerStream: ss, hashKey: hashKey})
+	}
+}
+
+// hashingStream checks the hash of messages as they are received.
+type hashingStream struct {
+	grpc.ServerStream
+	hashKey string
+}
+
+func (s *hashingStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return checkHash(m, s.hashKey)
+}
+
+// checkHash compares the hash of metrics in the request with the hash sent by the client.
+func checkHash(req any, hashKey string) error {
+	var data []byte
+	var reqHash string
+	switch r := req.(type) {
+	case *proto.UpdateMetricRequest:
+		data = []byte(r.GetMetric().String())
+		reqHash = r.GetHash()
+	case *proto.UpdateMetricsRequest:
+		var err error
+		data, err = protoconv.MarshalBatch(r.GetMetrics())
 		if err != nil {
-			return nil, status.Error(codes.Internal, "Unable to get hash for incomming metric")
+			return status.Error(codes.Internal, "Unable to encode incomming metrics")
 		}
+		reqHash = r.GetHash()
+	default:
+		return nil
+	}
 
-		if h != updateMetricRequest.GetHash() {
-			return nil, status.Error(codes.PermissionDenied, "Incorrect hash")
-		}
+	h, err := hash.Encode(data, hashKey)
+	if err != nil {
+		return status.Error(codes.Internal, "Unable to get hash for incomming metric")
+	}
 
-		return handler(ctx, req)
+	if h != reqHash {
+		return status.Error(codes.PermissionDenied, "Incorrect hash")
 	}
+	return nil
 }
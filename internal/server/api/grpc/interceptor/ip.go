@@ -19,22 +19,46 @@ func WithIPResolving(trustedSubnet string) func(
 	handler grpc.UnaryHandler,
 ) (any, error) {
 	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
-		ipReq, err := resolveIP(ctx)
-		if err != nil {
-			return nil, status.Error(codes.Internal, err.Error())
+		if err := checkIP(ctx, trustedSubnet); err != nil {
+			return nil, err
 		}
 
-		_, ipnet, err := net.ParseCIDR(trustedSubnet)
-		if err != nil {
-			return nil, status.Error(codes.Internal, err.Error())
-		}
+		return handler(ctx, req)
+	}
+}
 
-		if !ipnet.Contains(ipReq) {
-			return nil, status.Error(codes.PermissionDenied, "mUntrusted IP address")
+// WithStreamIPResolving is a gRPC server-side stream interceptor for checking if the client's IP address is within a trusted subnet.
+func WithStreamIPResolving(trustedSubnet string) func(
+	srv any,
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := checkIP(ss.Context(), trustedSubnet); err != nil {
+			return err
 		}
 
-		return handler(ctx, req)
+		return handler(srv, ss)
+	}
+}
+
+// checkIP returns a gRPC status error if the client's IP address is not within the trusted subnet.
+func checkIP(ctx context.Context, trustedSubnet string) error {
+	ipReq, err := resolveIP(ctx)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	_, ipnet, err := net.ParseCIDR(trustedSubnet)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	if !ipnet.Contains(ipReq) {
+		return status.Error(codes.PermissionDenied, "mUntrusted IP address")
 	}
+	return nil
 }
 
 // resolveIP extracts the client's IP address from the gRPC request context by reading the "x-real-ip" metadata.
@@ -24,3 +24,20 @@ func WithLogging(ctx context.Context, req any, info *grpc.UnaryServerInfo, handl
 
 	return res, err
 }
+
+// WithStreamLogging is a gRPC Stream Server interceptor for logging the details of incoming streams.
+// It logs the method name and the time it takes to process the whole stream.
+func WithStreamLogging(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	method := info.FullMethod
+
+	err := handler(srv, ss)
+
+	duration := time.Since(start)
+	log.Debug().
+		Str("method", method).
+		Str("duration", duration.String()).
+		Msg("got incoming grpc stream")
+
+	return err
+}
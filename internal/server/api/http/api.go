@@ -17,8 +17,8 @@ type httpAPI struct {
 	router  *chi.Mux
 }
 
-func New(conf *config.Config, storage service.Storage) *httpAPI {
-	srv := service.New(storage, conf)
+func New(conf *config.Config, storage service.Storage, alerts service.Alerts) *httpAPI {
+	srv := service.New(storage, conf, alerts)
 	newAPI := httpAPI{
 		service: srv,
 		conf:    conf,
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"encoding/json"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -13,6 +14,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/ulixes-bloom/ya-metrics/internal/pkg/headers"
+	"github.com/ulixes-bloom/ya-metrics/internal/server/alerting"
 	"github.com/ulixes-bloom/ya-metrics/internal/server/config"
 	"github.com/ulixes-bloom/ya-metrics/internal/server/storage/memory"
 )
@@ -46,7 +48,7 @@ func TestUpdateMetric(t *testing.T) {
 		expectedCode int
 	}
 	ms, _ := memory.NewStorage(ctx, Config)
-	newServer := New(Config, ms)
+	newServer := New(Config, ms, nil)
 	ts := httptest.NewServer(newServer.router)
 	defer ts.Close()
 
@@ -102,6 +104,14 @@ func TestUpdateMetric(t *testing.T) {
 				expectedCode: http.StatusOK,
 			},
 		},
+		{
+			name: "Return all metrics in prometheus format",
+			args: args{
+				url:          "/metrics",
+				method:       http.MethodGet,
+				expectedCode: http.StatusOK,
+			},
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -124,7 +134,7 @@ func TestUpdateJSONMetric(t *testing.T) {
 		body         []byte
 	}
 	ms, _ := memory.NewStorage(ctx, Config)
-	newServer := New(Config, ms)
+	newServer := New(Config, ms, nil)
 	ts := httptest.NewServer(newServer.router)
 	defer ts.Close()
 
@@ -198,7 +208,7 @@ func TestGzipCompression(t *testing.T) {
 		body         []byte
 	}
 	ms, _ := memory.NewStorage(ctx, Config)
-	newServer := New(Config, ms)
+	newServer := New(Config, ms, nil)
 	ts := httptest.NewServer(newServer.router)
 	defer ts.Close()
 
@@ -249,3 +259,313 @@ func TestGzipCompression(t *testing.T) {
 		})
 	}
 }
+
+func TestLabeledMetrics(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), contextTimeout)
+	defer cancel()
+
+	ms, _ := memory.NewStorage(ctx, Config)
+	newServer := New(Config, ms, nil)
+	ts := httptest.NewServer(newServer.router)
+	defer ts.Close()
+
+	updates := []struct {
+		method string
+		url    string
+		body   []byte
+	}{
+		{http.MethodPost, "/update/", []byte(`{"id":"LabeledGauge","type":"gauge","value":1,"labels":{"host":"a"}}`)},
+		{http.MethodPost, "/update/", []byte(`{"id":"LabeledGauge","type":"gauge","value":2,"labels":{"host":"b"}}`)},
+		{http.MethodPost, "/update/gauge/LabeledGauge/3", nil},
+		{http.MethodPost, "/update/counter/LabeledCounter/4?host=a", nil},
+		{http.MethodPost, "/updates/", []byte(`[{"id":"LabeledCounter","type":"counter","delta":5,"labels":{"host":"a"}}]`)},
+	}
+	for _, u := range updates {
+		resp, _ := testRequest(t, ts, u.method, u.url, u.body)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	tests := []struct {
+		name         string
+		method       string
+		url          string
+		body         []byte
+		expectedBody string
+	}{
+		{
+			name:         "Gauge with labels from query",
+			method:       http.MethodGet,
+			url:          "/value/gauge/LabeledGauge?host=b",
+			expectedBody: "2",
+		},
+		{
+			name:         "Gauge without labels",
+			method:       http.MethodGet,
+			url:          "/value/gauge/LabeledGauge",
+			expectedBody: "3",
+		},
+		{
+			name:         "Counter accumulated per series",
+			method:       http.MethodGet,
+			url:          "/value/counter/LabeledCounter?host=a",
+			expectedBody: "9",
+		},
+		{
+			name:         "Gauge with labels from json",
+			method:       http.MethodPost,
+			url:          "/value/",
+			body:         []byte(`{"id":"LabeledGauge","type":"gauge","labels":{"host":"a"}}`),
+			expectedBody: `{"id":"LabeledGauge","type":"gauge","value":1,"labels":{"host":"a"}}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, body := testRequest(t, ts, test.method, test.url, test.body)
+			defer resp.Body.Close()
+
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, test.expectedBody, body)
+		})
+	}
+}
+
+func TestAggregateMetrics(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), contextTimeout)
+	defer cancel()
+
+	ms, _ := memory.NewStorage(ctx, Config)
+	newServer := New(Config, ms, nil)
+	ts := httptest.NewServer(newServer.router)
+	defer ts.Close()
+
+	tests := []struct {
+		name         string
+		url          string
+		body         []byte
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "First histogram update",
+			url:          "/update/",
+			body:         []byte(`{"id":"Latency","type":"histogram","count":2,"sum":0.4,"buckets":[{"le":0.1,"count":1},{"le":0.5,"count":2}]}`),
+			expectedCode: http.StatusOK,
+			expectedBody: `{"id":"Latency","type":"histogram","count":2,"sum":0.4,"buckets":[{"le":0.1,"count":1},{"le":0.5,"count":2}]}`,
+		},
+		{
+			name:         "Histogram update is merged",
+			url:          "/update/",
+			body:         []byte(`{"id":"Latency","type":"histogram","count":3,"sum":2,"buckets":[{"le":0.1,"count":0},{"le":0.5,"count":1}]}`),
+			expectedCode: http.StatusOK,
+			expectedBody: `{"id":"Latency","type":"histogram","count":5,"sum":2.4,"buckets":[{"le":0.1,"count":1},{"le":0.5,"count":3}]}`,
+		},
+		{
+			name:         "Histogram with changed bounds",
+			url:          "/update/",
+			body:         []byte(`{"id":"Latency","type":"histogram","count":1,"sum":1,"buckets":[{"le":1,"count":1}]}`),
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "Histogram with non cumulative buckets",
+			url:          "/update/",
+			body:         []byte(`{"id":"Other","type":"histogram","count":2,"sum":1,"buckets":[{"le":0.1,"count":2},{"le":0.5,"count":1}]}`),
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "Summary update",
+			url:          "/update/",
+			body:         []byte(`{"id":"Size","type":"summary","count":10,"sum":100,"quantiles":[{"quantile":0.5,"value":8},{"quantile":0.99,"value":30}]}`),
+			expectedCode: http.StatusOK,
+			expectedBody: `{"id":"Size","type":"summary","count":10,"sum":100,"quantiles":[{"quantile":0.5,"value":8},{"quantile":0.99,"value":30}]}`,
+		},
+		{
+			name:         "Summary with invalid quantile",
+			url:          "/update/",
+			body:         []byte(`{"id":"Size","type":"summary","count":1,"sum":1,"quantiles":[{"quantile":2,"value":1}]}`),
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, body := testRequest(t, ts, http.MethodPost, test.url, test.body)
+			defer resp.Body.Close()
+
+			assert.Equal(t, test.expectedCode, resp.StatusCode)
+			if test.expectedBody != "" {
+				assert.Equal(t, test.expectedBody, body)
+			}
+		})
+	}
+
+	resp, body := testRequest(t, ts, http.MethodGet, "/value/histogram/Latency", nil)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "count=5 sum=2.4 buckets=[0.1:1 0.5:3]", body)
+}
+
+func TestMetricRange(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), contextTimeout)
+	defer cancel()
+
+	historyConfig := *Config
+	historyConfig.HistoryEnabled = true
+	historyConfig.HistorySize = 2
+
+	ms, _ := memory.NewStorage(ctx, &historyConfig)
+	newServer := New(&historyConfig, ms, nil)
+	ts := httptest.NewServer(newServer.router)
+	defer ts.Close()
+
+	for _, url := range []string{"/update/gauge/HeapAlloc/1", "/update/gauge/HeapAlloc/2", "/update/gauge/HeapAlloc/3"} {
+		resp, _ := testRequest(t, ts, http.MethodPost, url, nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	resp, body := testRequest(t, ts, http.MethodGet, "/api/v1/query_range?id=HeapAlloc", nil)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var result struct {
+		ID     string
+		Points []struct {
+			Timestamp time.Time
+			Value     float64
+		}
+	}
+	require.NoError(t, json.Unmarshal([]byte(body), &result))
+	assert.Equal(t, "HeapAlloc", result.ID)
+	require.Len(t, result.Points, 2)
+	assert.Equal(t, float64(2), result.Points[0].Value)
+	assert.Equal(t, float64(3), result.Points[1].Value)
+
+	resp, body = testRequest(t, ts, http.MethodGet, "/api/v1/query_range?id=HeapAlloc&step=1h", nil)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, json.Unmarshal([]byte(body), &result))
+	require.Len(t, result.Points, 1)
+	assert.Equal(t, float64(3), result.Points[0].Value)
+
+	resp, _ = testRequest(t, ts, http.MethodGet, "/api/v1/query_range?id=HeapAlloc&from=now", nil)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	for _, query := range []string{"step=1ns", "step=1e-12", "from=0&step=1m"} {
+		resp, _ = testRequest(t, ts, http.MethodGet, "/api/v1/query_range?id=HeapAlloc&"+query, nil)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, query)
+	}
+}
+
+func TestMetricRangeWithoutHistory(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), contextTimeout)
+	defer cancel()
+
+	ms, _ := memory.NewStorage(ctx, Config)
+	newServer := New(Config, ms, nil)
+	ts := httptest.NewServer(newServer.router)
+	defer ts.Close()
+
+	resp, _ := testRequest(t, ts, http.MethodGet, "/api/v1/query_range?id=HeapAlloc", nil)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusNotImplemented, resp.StatusCode)
+}
+
+func TestUpdateTypeMismatch(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), contextTimeout)
+	defer cancel()
+
+	ms, _ := memory.NewStorage(ctx, Config)
+	newServer := New(Config, ms, nil)
+	ts := httptest.NewServer(newServer.router)
+	defer ts.Close()
+
+	tests := []struct {
+		name string
+		path string
+		body []byte
+	}{
+		{name: "Counter of a gauge series", path: "/update/counter/Alloc/1"},
+		{name: "Gauge of a counter series", path: "/update/", body: []byte(`{"id":"PollCount","type":"gauge","value":1}`)},
+		{name: "Batch with a counter of a gauge series", path: "/updates/", body: []byte(`[{"id":"Alloc","type":"counter","delta":1}]`)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, _ := testRequest(t, ts, http.MethodPost, test.path, test.body)
+			defer resp.Body.Close()
+			assert.Equal(t, http.StatusConflict, resp.StatusCode)
+		})
+	}
+}
+
+func TestGetMetricTypeMismatch(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), contextTimeout)
+	defer cancel()
+
+	ms, _ := memory.NewStorage(ctx, Config)
+	newServer := New(Config, ms, nil)
+	ts := httptest.NewServer(newServer.router)
+	defer ts.Close()
+
+	tests := []struct {
+		name         string
+		path         string
+		expectedCode int
+	}{
+		{name: "Gauge series", path: "/value/gauge/Alloc", expectedCode: http.StatusOK},
+		{name: "Gauge series looked up as counter", path: "/value/counter/Alloc", expectedCode: http.StatusNotFound},
+		{name: "Counter series looked up as gauge", path: "/value/gauge/PollCount", expectedCode: http.StatusNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, _ := testRequest(t, ts, http.MethodGet, test.path, nil)
+			defer resp.Body.Close()
+			assert.Equal(t, test.expectedCode, resp.StatusCode)
+		})
+	}
+}
+
+func TestPingWithoutDatabase(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), contextTimeout)
+	defer cancel()
+
+	ms, _ := memory.NewStorage(ctx, Config)
+	newServer := New(Config, ms, nil)
+	ts := httptest.NewServer(newServer.router)
+	defer ts.Close()
+
+	resp, _ := testRequest(t, ts, http.MethodGet, "/ping", nil)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+}
+
+func TestAlerts(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), contextTimeout)
+	defer cancel()
+
+	conf := config.GetDefault()
+	conf.AlertRules = []config.AlertRule{
+		{Name: "HighCPU", Expr: `CPUutilization1{host="a"} > 90`, Labels: map[string]string{"severity": "page"}},
+	}
+	ms, _ := memory.NewStorage(ctx, conf)
+	alerts, err := alerting.New(conf, ms, nil)
+	require.NoError(t, err)
+	newServer := New(conf, ms, alerts)
+	ts := httptest.NewServer(newServer.router)
+	defer ts.Close()
+
+	resp, _ := testRequest(t, ts, http.MethodPost, "/update/gauge/CPUutilization1/95?host=a", nil)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, alerts.Evaluate(ctx, time.Now()))
+
+	resp, body := testRequest(t, ts, http.MethodGet, "/api/v1/alerts", nil)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var got []alerting.Alert
+	require.NoError(t, json.Unmarshal([]byte(body), &got))
+	require.Len(t, got, 1)
+	assert.Equal(t, "HighCPU", got[0].Rule)
+	assert.Equal(t, alerting.StateFiring, got[0].State)
+	assert.Equal(t, map[string]string{"host": "a", "severity": "page"}, got[0].Labels)
+}
@@ -2,15 +2,22 @@ package httpapi
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/rs/zerolog/log"
+	appErrors "github.com/ulixes-bloom/ya-metrics/internal/pkg/errors"
 	"github.com/ulixes-bloom/ya-metrics/internal/pkg/headers"
 	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/prometheus"
 )
 
 // GetMetric handles the HTTP request to retrieve a metric by its type and name.
+// Labels of the series are taken from the query string, e.g. /value/gauge/Alloc?host=a.
 // It responds with the metric's value if found, or an error if not.
 func (a *httpAPI) GetMetric(res http.ResponseWriter, req *http.Request) {
 	ctx := req.Context()
@@ -22,17 +29,20 @@ func (a *httpAPI) GetMetric(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	mval, err := a.service.GetMetric(ctx, mtype, mname)
+	mval, err := a.service.GetMetric(ctx, mtype, mname, queryLabels(req))
 	if err != nil {
 		log.Error().Msg(err.Error())
 		http.Error(res, err.Error(), http.StatusNotFound)
+		return
 	}
 
 	res.Header().Add(headers.ContentType, "text/plain")
+	res.WriteHeader(http.StatusOK)
 	res.Write([]byte(mval))
 }
 
 // UpdateMetric handles the HTTP request to update a metric's value by its type, name, and value.
+// Labels of the series are taken from the query string.
 // It responds with a success status or an error if the update fails.
 func (a *httpAPI) UpdateMetric(res http.ResponseWriter, req *http.Request) {
 	ctx := req.Context()
@@ -45,9 +55,9 @@ func (a *httpAPI) UpdateMetric(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	err := a.service.UpdateMetric(ctx, mtype, mname, mval)
+	err := a.service.UpdateMetric(ctx, mtype, mname, mval, queryLabels(req))
 	if err != nil {
-		http.Error(res, err.Error(), http.StatusBadRequest)
+		http.Error(res, err.Error(), updateErrorStatus(err))
 		return
 	}
 
@@ -70,7 +80,7 @@ func (a *httpAPI) UpdateMetrics(res http.ResponseWriter, req *http.Request) {
 	err := a.service.UpdateMetrics(ctx, m)
 	if err != nil {
 		log.Error().Msg(err.Error())
-		http.Error(res, err.Error(), http.StatusBadRequest)
+		http.Error(res, err.Error(), updateErrorStatus(err))
 		return
 	}
 
@@ -94,6 +104,23 @@ func (a *httpAPI) GetMetricsHTMLTable(res http.ResponseWriter, req *http.Request
 	res.Write(table)
 }
 
+// GetMetricsPrometheus handles the HTTP request to retrieve all metrics in the Prometheus text exposition format.
+// It responds with the rendered metrics or an error if the retrieval fails.
+func (a *httpAPI) GetMetricsPrometheus(res http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	body, err := a.service.GetMetricsPrometheus(ctx)
+	if err != nil {
+		log.Error().Msg(err.Error())
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Add(headers.ContentType, prometheus.ContentType)
+	res.WriteHeader(http.StatusOK)
+	res.Write(body)
+}
+
 // GetJSONMetric handles the HTTP request to retrieve a metric as a JSON object based on the provided metric name.
 // It responds with the metric data in JSON format or an error if the metric is not found.
 func (a *httpAPI) GetJSONMetric(res http.ResponseWriter, req *http.Request) {
@@ -133,7 +160,7 @@ func (a *httpAPI) UpdateJSONMetric(res http.ResponseWriter, req *http.Request) {
 	metric, err := a.service.UpdateJSONMetric(ctx, m)
 	if err != nil {
 		log.Error().Msg(err.Error())
-		http.Error(res, err.Error(), http.StatusBadRequest)
+		http.Error(res, err.Error(), updateErrorStatus(err))
 		return
 	}
 
@@ -142,10 +169,104 @@ func (a *httpAPI) UpdateJSONMetric(res http.ResponseWriter, req *http.Request) {
 	res.Write(metric)
 }
 
+// GetMetricRange handles the HTTP request to retrieve the history of a series,
+// e.g. /api/v1/query_range?id=HeapAlloc&from=1700000000&to=1700003600&step=60s.
+// Time bounds are RFC 3339 timestamps or unix seconds, from defaults to an hour before to,
+// which defaults to now. Step is a duration or a number of seconds, without it raw samples are returned,
+// a step splitting the range into more than 11000 points is rejected.
+// Other query parameters are the labels of the series.
+func (a *httpAPI) GetMetricRange(res http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	query := req.URL.Query()
+	id := query.Get("id")
+	if id == "" {
+		http.Error(res, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	to := time.Now()
+	if query.Has("to") {
+		t, err := parseTime(query.Get("to"))
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+		to = t
+	}
+	from := to.Add(-time.Hour)
+	if query.Has("from") {
+		t, err := parseTime(query.Get("from"))
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+	var step time.Duration
+	if query.Has("step") {
+		d, err := parseStep(query.Get("step"))
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+		step = d
+	}
+	if from.After(to) {
+		http.Error(res, "from is after to", http.StatusBadRequest)
+		return
+	}
+
+	for _, param := range []string{"id", "from", "to", "step"} {
+		query.Del(param)
+	}
+	var labels map[string]string
+	if len(query) > 0 {
+		labels = make(map[string]string, len(query))
+		for name, values := range query {
+			labels[name] = values[0]
+		}
+	}
+
+	body, err := a.service.GetMetricRange(ctx, id, labels, from, to, step)
+	if err != nil {
+		log.Error().Msg(err.Error())
+		if errors.Is(err, appErrors.ErrHistoryNotEnabled) {
+			http.Error(res, err.Error(), http.StatusNotImplemented)
+			return
+		}
+		if errors.Is(err, appErrors.ErrTooManyPoints) {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Add(headers.ContentType, "application/json")
+	res.WriteHeader(http.StatusOK)
+	res.Write(body)
+}
+
+// GetAlerts handles the HTTP request to list the alerts produced by the alerting rules.
+// It responds with a JSON array of pending, firing and recently resolved alerts.
+func (a *httpAPI) GetAlerts(res http.ResponseWriter, req *http.Request) {
+	body, err := a.service.GetAlerts(req.Context())
+	if err != nil {
+		log.Error().Msg(err.Error())
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Add(headers.ContentType, "application/json")
+	res.WriteHeader(http.StatusOK)
+	res.Write(body)
+}
+
 // PingDB handles the HTTP request to check the database connection status.
 // It responds with a success status if the database is reachable, or an error if it is not.
 func (a *httpAPI) PingDB(res http.ResponseWriter, req *http.Request) {
-	err := a.service.PingDB(a.conf.DatabaseDSN)
+	err := a.service.PingDB(req.Context())
 	if err != nil {
 		log.Error().Msg(err.Error())
 		res.WriteHeader(http.StatusInternalServerError)
@@ -154,3 +275,52 @@ func (a *httpAPI) PingDB(res http.ResponseWriter, req *http.Request) {
 
 	res.WriteHeader(http.StatusOK)
 }
+
+// updateErrorStatus returns the response status of a failed update,
+// 409 Conflict if a metric does not match the type of its stored series.
+func updateErrorStatus(err error) int {
+	if errors.Is(err, appErrors.ErrMetricTypeMismatch) {
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
+
+// queryLabels converts the request query parameters to metric labels.
+// If a label is repeated, its first value is used.
+func queryLabels(req *http.Request) map[string]string {
+	query := req.URL.Query()
+	if len(query) == 0 {
+		return nil
+	}
+
+	labels := make(map[string]string, len(query))
+	for name, values := range query {
+		labels[name] = values[0]
+	}
+	return labels
+}
+
+// parseTime parses a query time given as RFC 3339 timestamp or unix seconds.
+func parseTime(val string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, val); err == nil {
+		return t, nil
+	}
+	sec, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("httpapi.parseTime: invalid time '%s'", val)
+	}
+	return time.UnixMilli(int64(sec * 1000)), nil
+}
+
+// parseStep parses a query step given as duration or number of seconds.
+func parseStep(val string) (time.Duration, error) {
+	if d, err := time.ParseDuration(val); err == nil && d > 0 {
+		return d, nil
+	}
+	sec, err := strconv.ParseFloat(val, 64)
+	step := time.Duration(sec * float64(time.Second))
+	if err != nil || step <= 0 {
+		return 0, fmt.Errorf("httpapi.parseStep: invalid step '%s'", val)
+	}
+	return step, nil
+}
@@ -16,6 +16,9 @@ func (a *httpAPI) newRouter() *chi.Mux {
 
 	r.Get("/", a.GetMetricsHTMLTable)
 	r.Get("/ping", a.PingDB)
+	r.Get("/metrics", a.GetMetricsPrometheus)
+	r.Get("/api/v1/query_range", a.GetMetricRange)
+	r.Get("/api/v1/alerts", a.GetAlerts)
 	r.Get("/value/{mtype}/{mname}", a.GetMetric)
 	r.Post("/update/{mtype}/{mname}/{mval}", a.UpdateMetric)
 
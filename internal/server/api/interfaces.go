@@ -2,17 +2,24 @@ package api
 
 import (
 	"context"
+	"time"
 
 	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
 )
 
 type Service interface {
-	GetMetric(ctx context.Context, mtype, mname string) ([]byte, error)
-	UpdateMetric(ctx context.Context, mtype, mname, mval string) error
+	GetMetric(ctx context.Context, mtype, mname string, labels map[string]string) ([]byte, error)
+	UpdateMetric(ctx context.Context, mtype, mname, mval string, labels map[string]string) error
 	UpdateMetrics(ctx context.Context, m []metrics.Metric) error
 	GetMetricsHTMLTable(ctx context.Context) ([]byte, error)
+	GetMetricsPrometheus(ctx context.Context) ([]byte, error)
 	GetJSONMetric(ctx context.Context, metric metrics.Metric) ([]byte, error)
+	GetAlerts(ctx context.Context) ([]byte, error)
+	FindMetric(ctx context.Context, id string, labels map[string]string) (metrics.Metric, error)
+	ListMetrics(ctx context.Context, idPrefix, mtype string) ([]metrics.Metric, error)
+	WatchMetrics(ctx context.Context, idPrefix, mtype string) (<-chan metrics.Metric, error)
+	GetMetricRange(ctx context.Context, id string, labels map[string]string, from, to time.Time, step time.Duration) ([]byte, error)
 	UpdateJSONMetric(ctx context.Context, metric metrics.Metric) ([]byte, error)
-	PingDB(dsn string) error
+	PingDB(ctx context.Context) error
 	Shutdown(ctx context.Context) error
 }
@@ -7,26 +7,78 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"dario.cat/mergo"
 	"github.com/caarlos0/env"
+	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
 	RunAddr         string `env:"ADDRESS" json:"address"`                     // The address and port for the http server to listen on.
 	LogLvl          string `env:"LOGLVL" json:"loglvl"`                       // The logging level to be used (e.g., Info, Debug).
-	StoreInterval   int    `env:"STORE_INTERVAL" json:"store_interval"`       // Interval at which metrics are stored.
+	StoreInterval   int    `env:"STORE_INTERVAL" json:"store_interval"`       // Interval at which metrics are stored, 0 logs every update to the write-ahead log.
 	FileStoragePath string `env:"FILE_STORAGE_PATH" json:"file_storage_path"` // Path to store metrics data in a file.
 	Restore         bool   `env:"RESTORE" json:"restore"`                     // Flag to determine if metrics should be restored from storage.
+	SnapshotKeep    int    `env:"SNAPSHOT_KEEP" json:"snapshot_keep"`         // Number of previous snapshots kept as a fallback for a corrupt one.
+	WALCompact      int    `env:"WAL_COMPACT" json:"wal_compact"`             // Interval at which the write-ahead log is folded into a snapshot.
 	DatabaseDSN     string `env:"DATABASE_DSN" json:"database_dsn"`           // Data source name for connecting to a PostgreSQL database.
+	DBMaxConns      int    `env:"DB_MAX_CONNS" json:"db_max_conns"`           // Maximum number of connections in the database pool.
+	DBMinConns      int    `env:"DB_MIN_CONNS" json:"db_min_conns"`           // Number of connections the database pool keeps open.
+	DBConnLifetime  int    `env:"DB_CONN_LIFETIME" json:"db_conn_lifetime"`   // Interval after which a database connection is closed.
+	DBConnIdleTime  int    `env:"DB_CONN_IDLE_TIME" json:"db_conn_idle_time"` // Interval after which an idle database connection is closed.
+	DBStmtCache     int    `env:"DB_STMT_CACHE" json:"db_stmt_cache"`         // Number of prepared statements cached per connection, 0 disables preparing.
 	HashKey         string `env:"KEY" json:"hash_key"`                        // Key used for signing and validating metrics data.
 	PrivateKey      string `env:"CRYPTO_KEY" json:"crypto_key"`               // Private key for data decryption in http and TLS connecion in grpc.
 	PublicKey       string `env:"CRYPTO_PUBLIC_KEY" json:"crypto_public_key"` // Public key for TLS connection in grpc.
 	TrustedSubnet   string `env:"TRUSTED_SUBNET" json:"trusted_subnet"`       // Trused agent subnet.
 	GRPCRunAddr     string `env:"GRPC_ADDRESS" json:"grpc_address"`           // The address and port for the grpc server to listen on.
+	HistoryEnabled  bool   `env:"HISTORY" json:"history"`                     // Flag to keep timestamped samples of every series.
+	HistorySize     int    `env:"HISTORY_SIZE" json:"history_size"`           // Number of samples kept per series by the memory storage.
+	Retention       string `env:"RETENTION" json:"retention"`                 // History retention policy, e.g. "raw:24h,1m:30d,1h:365d".
+	CompactInterval int    `env:"COMPACT_INTERVAL" json:"compact_interval"`   // Interval at which history is downsampled and expired.
+	AlertRulesPath  string `env:"ALERT_RULES" json:"alert_rules"`             // Path to the YAML or JSON file with alerting rules.
+	AlertInterval   int    `env:"ALERT_INTERVAL" json:"alert_interval"`       // Interval at which alerting rules are evaluated.
+	AlertWebhooks   string `env:"ALERT_WEBHOOKS" json:"alert_webhooks"`       // Comma separated webhook URLs receiving alert notifications.
+	AlertGroupBy    string `env:"ALERT_GROUP_BY" json:"alert_group_by"`       // Comma separated labels grouping alerts of a rule into one notification.
+	AlertRepeat     int    `env:"ALERT_REPEAT" json:"alert_repeat"`           // Interval at which notifications of still firing alerts are repeated.
+
+	AlertRules []AlertRule `json:"-"` // Alerting rules read from AlertRulesPath.
+}
+
+// AlertRule describes a single alerting rule of the rules file.
+// Expr compares a series with a threshold and may require the condition to hold for a while,
+// e.g. `CPUutilization1 > 90 for 5m` or `Alloc{host="a"} >= 1e9`.
+type AlertRule struct {
+	Name   string            `json:"name" yaml:"name"`     // Unique rule name.
+	Expr   string            `json:"expr" yaml:"expr"`     // Alert condition.
+	Labels map[string]string `json:"labels" yaml:"labels"` // Labels attached to alerts of the rule (optional).
+}
+
+// RetentionLevel describes how long history samples of a single resolution are kept.
+// The raw level has zero Resolution, a zero Period keeps samples forever.
+type RetentionLevel struct {
+	Resolution time.Duration
+	Period     time.Duration
+}
+
+// RetentionPolicy is a list of retention levels ordered by resolution, starting with the raw level.
+type RetentionPolicy []RetentionLevel
+
+// LevelFor returns the index of the finest level that still keeps samples of the given age.
+// If no level keeps them, the coarsest level is returned.
+func (p RetentionPolicy) LevelFor(age time.Duration) int {
+	for i, l := range p {
+		if l.Period == 0 || age <= l.Period {
+			return i
+		}
+	}
+	return len(p) - 1
 }
 
 // Parse parses the configuration from command-line flags and environment variables.
@@ -55,13 +107,29 @@ func Parse() (*Config, error) {
 	flag.IntVar(&conf.StoreInterval, "i", conf.StoreInterval, "store interval")
 	flag.StringVar(&conf.FileStoragePath, "f", conf.FileStoragePath, "file storage path")
 	flag.BoolVar(&conf.Restore, "r", conf.Restore, "to restore metrics data")
+	flag.IntVar(&conf.SnapshotKeep, "snapshot-keep", conf.SnapshotKeep, "number of previous snapshots kept")
+	flag.IntVar(&conf.WALCompact, "wal-compact", conf.WALCompact, "write-ahead log compact interval")
 	flag.StringVar(&conf.DatabaseDSN, "d", conf.DatabaseDSN, "postgresql data source name")
+	flag.IntVar(&conf.DBMaxConns, "db-max-conns", conf.DBMaxConns, "maximum number of database connections")
+	flag.IntVar(&conf.DBMinConns, "db-min-conns", conf.DBMinConns, "number of database connections kept open")
+	flag.IntVar(&conf.DBConnLifetime, "db-conn-lifetime", conf.DBConnLifetime, "database connection lifetime")
+	flag.IntVar(&conf.DBConnIdleTime, "db-conn-idle-time", conf.DBConnIdleTime, "database connection idle time")
+	flag.IntVar(&conf.DBStmtCache, "db-stmt-cache", conf.DBStmtCache, "number of prepared statements cached per database connection")
 	flag.StringVar(&conf.HashKey, "k", conf.HashKey, "key to sign the metrics data")
 	flag.StringVar(&conf.PrivateKey, "crypto-key", conf.PrivateKey, "private key for data decryption in http and TLS connecion in grpc")
 	flag.StringVar(&conf.PublicKey, "public-key", conf.PublicKey, "public key for TLS connection in grpc")
 	flag.StringVar(&configFile, "c", configFile, "json file with configuration")
 	flag.StringVar(&conf.TrustedSubnet, "t", conf.TrustedSubnet, "trusted ip adresses (CIDR notation)")
 	flag.StringVar(&conf.GRPCRunAddr, "ga", conf.GRPCRunAddr, "address and port to run grpc server (default :3200)")
+	flag.BoolVar(&conf.HistoryEnabled, "history", conf.HistoryEnabled, "to keep metrics history")
+	flag.IntVar(&conf.HistorySize, "history-size", conf.HistorySize, "number of samples kept per series in memory")
+	flag.StringVar(&conf.Retention, "retention", conf.Retention, "history retention policy (e.g. raw:24h,1m:30d,1h:365d)")
+	flag.IntVar(&conf.CompactInterval, "compact-interval", conf.CompactInterval, "history compaction interval")
+	flag.StringVar(&conf.AlertRulesPath, "alert-rules", conf.AlertRulesPath, "yaml or json file with alerting rules")
+	flag.IntVar(&conf.AlertInterval, "alert-interval", conf.AlertInterval, "alerting rules evaluation interval")
+	flag.StringVar(&conf.AlertWebhooks, "alert-webhooks", conf.AlertWebhooks, "comma separated webhook urls for alert notifications")
+	flag.StringVar(&conf.AlertGroupBy, "alert-group-by", conf.AlertGroupBy, "comma separated labels to group alert notifications by")
+	flag.IntVar(&conf.AlertRepeat, "alert-repeat", conf.AlertRepeat, "repeat interval of firing alert notifications")
 	flag.Parse()
 
 	err = env.Parse(&conf)
@@ -72,6 +140,54 @@ func Parse() (*Config, error) {
 	if conf.StoreInterval < 0 {
 		return nil, errors.New("config.parse: negative store interval")
 	}
+	if conf.WALCompact <= 0 {
+		return nil, errors.New("config.parse: negative or zero wal compact interval")
+	}
+	if conf.SnapshotKeep < 0 {
+		return nil, errors.New("config.parse: negative number of kept snapshots")
+	}
+	if conf.DBMaxConns <= 0 {
+		return nil, errors.New("config.parse: negative or zero maximum number of database connections")
+	}
+	if conf.DBMinConns < 0 || conf.DBMinConns > conf.DBMaxConns {
+		return nil, errors.New("config.parse: number of kept database connections out of range")
+	}
+	if conf.DBConnLifetime <= 0 {
+		return nil, errors.New("config.parse: negative or zero database connection lifetime")
+	}
+	if conf.DBConnIdleTime <= 0 {
+		return nil, errors.New("config.parse: negative or zero database connection idle time")
+	}
+	if conf.DBStmtCache < 0 {
+		return nil, errors.New("config.parse: negative database statement cache size")
+	}
+	if conf.HistorySize <= 0 {
+		return nil, errors.New("config.parse: negative or zero history size")
+	}
+	if conf.CompactInterval <= 0 {
+		return nil, errors.New("config.parse: negative or zero compact interval")
+	}
+	if _, err = conf.GetRetentionPolicy(); err != nil {
+		return nil, fmt.Errorf("config.parse: %w", err)
+	}
+	if conf.AlertInterval <= 0 {
+		return nil, errors.New("config.parse: negative or zero alert interval")
+	}
+	if conf.AlertRepeat <= 0 {
+		return nil, errors.New("config.parse: negative or zero alert repeat interval")
+	}
+	for _, webhook := range conf.GetAlertWebhooks() {
+		if _, err = url.ParseRequestURI(webhook); err != nil {
+			return nil, fmt.Errorf("config.parse: invalid alert webhook: %w", err)
+		}
+	}
+
+	if conf.AlertRulesPath != "" {
+		conf.AlertRules, err = parseAlertRulesFromFile(conf.AlertRulesPath)
+		if err != nil {
+			return nil, fmt.Errorf("config.parse: %w", err)
+		}
+	}
 
 	return &conf, nil
 }
@@ -106,6 +222,30 @@ func parseConfigFromFile(fname string) (conf Config, err error) {
 	return conf, nil
 }
 
+// parseAlertRulesFromFile reads alerting rules from a YAML (.yaml, .yml) or JSON file
+// with the top level "rules" list.
+func parseAlertRulesFromFile(fname string) ([]AlertRule, error) {
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		return nil, fmt.Errorf("config.parseAlertRulesFromFile: %w", err)
+	}
+
+	var rulesFile struct {
+		Rules []AlertRule `json:"rules" yaml:"rules"`
+	}
+	switch filepath.Ext(fname) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &rulesFile)
+	default:
+		err = json.Unmarshal(data, &rulesFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config.parseAlertRulesFromFile: '%s', %w", fname, err)
+	}
+
+	return rulesFile.Rules, nil
+}
+
 // GetDefault returns a Config object populated with default values for all
 // configuration options. These defaults are used when no other values are
 // provided by the user through command-line flags or environment variables.
@@ -116,16 +256,137 @@ func GetDefault() (conf *Config) {
 		StoreInterval:   300,
 		FileStoragePath: "metrics_store.txt",
 		Restore:         true,
+		SnapshotKeep:    2,
+		WALCompact:      300,
 		DatabaseDSN:     "",
+		DBMaxConns:      10,
+		DBMinConns:      0,
+		DBConnLifetime:  3600,
+		DBConnIdleTime:  1800,
+		DBStmtCache:     512,
 		HashKey:         "",
 		PrivateKey:      "",
 		PublicKey:       "",
 		TrustedSubnet:   "",
 		GRPCRunAddr:     ":3200",
+		HistoryEnabled:  false,
+		HistorySize:     1000,
+		Retention:       "raw:24h,1m:30d,1h:365d",
+		CompactInterval: 60,
+		AlertRulesPath:  "",
+		AlertInterval:   15,
+		AlertWebhooks:   "",
+		AlertGroupBy:    "",
+		AlertRepeat:     3600,
 	}
 }
 
+// GetWALCompactIntervalDuration converts the WALCompact field to a time.Duration.
+func (c *Config) GetWALCompactIntervalDuration() time.Duration {
+	return time.Duration(c.WALCompact) * time.Second
+}
+
+// GetDBConnLifetimeDuration converts the DBConnLifetime field to a time.Duration.
+func (c *Config) GetDBConnLifetimeDuration() time.Duration {
+	return time.Duration(c.DBConnLifetime) * time.Second
+}
+
+// GetDBConnIdleTimeDuration converts the DBConnIdleTime field to a time.Duration.
+func (c *Config) GetDBConnIdleTimeDuration() time.Duration {
+	return time.Duration(c.DBConnIdleTime) * time.Second
+}
+
 // GetStoreIntervalDuration converts the StoreInterval field to a time.Duration.
 func (c *Config) GetStoreIntervalDuration() time.Duration {
 	return time.Duration(c.StoreInterval) * time.Second
 }
+
+// GetCompactIntervalDuration converts the CompactInterval field to a time.Duration.
+func (c *Config) GetCompactIntervalDuration() time.Duration {
+	return time.Duration(c.CompactInterval) * time.Second
+}
+
+// GetRetentionPolicy parses the Retention field into levels ordered by resolution.
+// Every level is written as "<resolution>:<period>", where the resolution of raw samples is "raw"
+// and durations may use a "d" suffix for days. Resolutions must be whole numbers of seconds.
+// The raw level is required, an empty policy keeps raw samples forever.
+func (c *Config) GetRetentionPolicy() (RetentionPolicy, error) {
+	if c.Retention == "" {
+		return RetentionPolicy{{}}, nil
+	}
+
+	var policy RetentionPolicy
+	for _, level := range strings.Split(c.Retention, ",") {
+		resolution, period, found := strings.Cut(strings.TrimSpace(level), ":")
+		if !found {
+			return nil, fmt.Errorf("config.getRetentionPolicy: invalid level '%s'", level)
+		}
+
+		var l RetentionLevel
+		var err error
+		if resolution != "raw" {
+			// rollups are aligned to whole seconds, as the database stores them in epoch seconds
+			l.Resolution, err = parseDays(resolution)
+			if err != nil || l.Resolution < time.Second || l.Resolution%time.Second != 0 {
+				return nil, fmt.Errorf("config.getRetentionPolicy: invalid resolution '%s'", resolution)
+			}
+		}
+		if l.Period, err = parseDays(period); err != nil || l.Period < 0 {
+			return nil, fmt.Errorf("config.getRetentionPolicy: invalid period '%s'", period)
+		}
+		policy = append(policy, l)
+	}
+
+	if policy[0].Resolution != 0 {
+		return nil, errors.New("config.getRetentionPolicy: policy must start with the raw level")
+	}
+	for i := 1; i < len(policy); i++ {
+		if policy[i].Resolution <= policy[i-1].Resolution {
+			return nil, errors.New("config.getRetentionPolicy: resolutions must be increasing")
+		}
+	}
+	return policy, nil
+}
+
+// parseDays parses a duration that may also be given in days, e.g. "30d".
+func parseDays(val string) (time.Duration, error) {
+	if days, found := strings.CutSuffix(val, "d"); found {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("config.parseDays: %w", err)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(val)
+}
+
+// GetAlertIntervalDuration converts the AlertInterval field to a time.Duration.
+func (c *Config) GetAlertIntervalDuration() time.Duration {
+	return time.Duration(c.AlertInterval) * time.Second
+}
+
+// GetAlertWebhooks splits the AlertWebhooks field into a list of URLs.
+func (c *Config) GetAlertWebhooks() []string {
+	return splitList(c.AlertWebhooks)
+}
+
+// GetAlertGroupBy splits the AlertGroupBy field into a list of label names.
+func (c *Config) GetAlertGroupBy() []string {
+	return splitList(c.AlertGroupBy)
+}
+
+// GetAlertRepeatDuration converts the AlertRepeat field to a time.Duration.
+func (c *Config) GetAlertRepeatDuration() time.Duration {
+	return time.Duration(c.AlertRepeat) * time.Second
+}
+
+// splitList splits a comma separated list, skipping empty items.
+func splitList(val string) []string {
+	var res []string
+	for _, item := range strings.Split(val, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			res = append(res, item)
+		}
+	}
+	return res
+}
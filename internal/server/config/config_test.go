@@ -0,0 +1,62 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetRetentionPolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		retention string
+		expected  RetentionPolicy
+		wantErr   bool
+	}{
+		{
+			name:      "Empty policy keeps raw samples",
+			retention: "",
+			expected:  RetentionPolicy{{}},
+		},
+		{
+			name:      "Levels",
+			retention: "raw:2d, 1m:30d",
+			expected:  RetentionPolicy{{Period: 48 * time.Hour}, {Resolution: time.Minute, Period: 720 * time.Hour}},
+		},
+		{
+			name:      "Missing raw level",
+			retention: "1m:30d",
+			wantErr:   true,
+		},
+		{
+			name:      "Decreasing resolutions",
+			retention: "raw:1d,5m:7d,1m:30d",
+			wantErr:   true,
+		},
+		{
+			name:      "Resolution below a second",
+			retention: "raw:1d,500ms:7d",
+			wantErr:   true,
+		},
+		{
+			name:      "Resolution of a fractional number of seconds",
+			retention: "raw:1d,1500ms:7d",
+			wantErr:   true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conf := GetDefault()
+			conf.Retention = test.retention
+			policy, err := conf.GetRetentionPolicy()
+			if test.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, policy)
+		})
+	}
+}
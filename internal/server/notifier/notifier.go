@@ -0,0 +1,291 @@
+// Package notifier delivers alert notifications to webhooks.
+//
+// Alerts of a rule are grouped by the configured labels and every group is sent as a single
+// JSON payload. A group is sent again only when a new alert of it starts firing, a firing alert
+// is resolved or the repeat interval since the previous notification has passed.
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/headers"
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/retry"
+	"github.com/ulixes-bloom/ya-metrics/internal/server/alerting"
+	"github.com/ulixes-bloom/ya-metrics/internal/server/config"
+)
+
+const (
+	sendAttempts = 3
+	sendTimeout  = 10 * time.Second
+)
+
+// Payload is the body of a webhook request.
+type Payload struct {
+	Status      string            `json:"status"`                 // "firing" if any alert of the group fires, "resolved" otherwise
+	Rule        string            `json:"rule"`                   // Name of the rule of the group
+	GroupLabels map[string]string `json:"group_labels,omitempty"` // Values of the labels the group is formed by
+	Alerts      []alerting.Alert  `json:"alerts"`                 // Firing and just resolved alerts of the group
+}
+
+// group is the state of the latest notification sent for a group of alerts.
+type group struct {
+	rule    string
+	labels  map[string]string
+	firing  map[string]alerting.Alert // alerts notified as firing by alert key
+	sentAt  time.Time
+	sending bool // a notification of the group is being sent
+}
+
+// notification is a payload due to be sent for a group.
+type notification struct {
+	key     string
+	payload *Payload
+	firing  map[string]alerting.Alert // firing alerts of the payload by alert key
+}
+
+type notifier struct {
+	webhooks []string
+	groupBy  []string
+	repeat   time.Duration
+	client   *http.Client
+	groups   map[string]*group
+	mutex    sync.Mutex
+}
+
+// statusError is returned when a webhook responds with an unsuccessful status code.
+type statusError struct {
+	url  string
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("webhook '%s' responded with status %d", e.url, e.code)
+}
+
+// New creates a notifier sending alerts to the webhooks from config.AlertWebhooks.
+func New(conf *config.Config) *notifier {
+	return &notifier{
+		webhooks: conf.GetAlertWebhooks(),
+		groupBy:  conf.GetAlertGroupBy(),
+		repeat:   conf.GetAlertRepeatDuration(),
+		client:   &http.Client{Timeout: sendTimeout},
+		groups:   make(map[string]*group),
+	}
+}
+
+// Notify sends notifications for the groups of the given alerts that changed since the previous call
+// or are due to be repeated. Groups failed to be delivered are sent again on the next call.
+// Failed deliveries are retried before Notify returns, unless the context is done.
+// Groups being sent by a concurrent call are skipped.
+func (n *notifier) Notify(ctx context.Context, now time.Time, alerts []alerting.Alert) error {
+	if len(n.webhooks) == 0 {
+		return nil
+	}
+
+	var errs []error
+	for _, nt := range n.prepare(now, alerts) {
+		err := n.send(ctx, nt.payload)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		n.finish(nt, now, err == nil)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("notifier.notify: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// prepare returns the notifications due to be sent and marks their groups as being sent.
+// Alerts notified as firing that are missing from the given alerts or are pending again
+// are notified as resolved, so a group is kept until its resolved notification is delivered.
+func (n *notifier) prepare(now time.Time, alerts []alerting.Alert) []notification {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	payloads := make(map[string]*Payload)
+	for _, a := range alerts {
+		if a.State == alerting.StatePending {
+			continue
+		}
+		key, labels := n.groupKey(a)
+		if _, ok := payloads[key]; !ok {
+			payloads[key] = &Payload{Rule: a.Rule, GroupLabels: labels}
+		}
+		payloads[key].Alerts = append(payloads[key].Alerts, a)
+	}
+	for key, g := range n.groups {
+		if _, ok := payloads[key]; !ok {
+			payloads[key] = &Payload{Rule: g.rule, GroupLabels: g.labels}
+		}
+	}
+
+	var res []notification
+	for key, p := range payloads {
+		g, ok := n.groups[key]
+		if !ok {
+			g = &group{rule: p.Rule, labels: p.GroupLabels}
+		}
+		if g.sending {
+			continue
+		}
+
+		firing := make(map[string]alerting.Alert)
+		seen := make(map[string]bool)
+		changed := false
+		alerts := p.Alerts[:0]
+		for _, a := range p.Alerts {
+			aKey := alertKey(a)
+			seen[aKey] = true
+			_, notified := g.firing[aKey]
+			switch a.State {
+			case alerting.StateFiring:
+				firing[aKey] = a
+				changed = changed || !notified
+				alerts = append(alerts, a)
+			case alerting.StateResolved:
+				// only alerts notified as firing are notified as resolved, and only once
+				if notified {
+					changed = true
+					alerts = append(alerts, a)
+				}
+			}
+		}
+
+		var gone []string
+		for aKey := range g.firing {
+			if !seen[aKey] {
+				gone = append(gone, aKey)
+			}
+		}
+		sort.Strings(gone)
+		for _, aKey := range gone {
+			a, resolvedAt := g.firing[aKey], now
+			a.State, a.ResolvedAt = alerting.StateResolved, &resolvedAt
+			changed = true
+			alerts = append(alerts, a)
+		}
+		p.Alerts = alerts
+
+		repeat := len(firing) > 0 && now.Sub(g.sentAt) >= n.repeat
+		if !changed && !repeat {
+			continue
+		}
+
+		p.Status = alerting.StateResolved
+		if len(firing) > 0 {
+			p.Status = alerting.StateFiring
+		}
+		g.sending = true
+		n.groups[key] = g
+		res = append(res, notification{key: key, payload: p, firing: firing})
+	}
+	return res
+}
+
+// finish records the outcome of sending the notification and releases its group.
+func (n *notifier) finish(nt notification, now time.Time, delivered bool) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	g := n.groups[nt.key]
+	g.sending = false
+	switch {
+	case delivered && len(nt.firing) == 0:
+		delete(n.groups, nt.key)
+	case delivered:
+		g.firing = nt.firing
+		g.sentAt = now
+	case len(g.firing) == 0:
+		// nothing of the group has been notified yet
+		delete(n.groups, nt.key)
+	}
+}
+
+// send posts the payload to every webhook.
+func (n *notifier) send(ctx context.Context, p *Payload) error {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("notifier.send: %w", err)
+	}
+
+	var errs []error
+	for _, webhook := range n.webhooks {
+		err := retry.Do(ctx, func() error { return n.post(ctx, webhook, body) }, needToRetry, sendAttempts)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		log.Debug().Str("webhook", webhook).Str("rule", p.Rule).Str("status", p.Status).Msg("alert notification sent")
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("notifier.send: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+func (n *notifier) post(ctx context.Context, webhook string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("notifier.post: %w", err)
+	}
+	req.Header.Set(headers.ContentType, "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("notifier.post: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &statusError{url: webhook, code: resp.StatusCode}
+	}
+	return nil
+}
+
+// needToRetry retries network errors and server side errors of webhooks.
+func needToRetry(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		return statusErr.code >= 500 || statusErr.code == http.StatusTooManyRequests
+	}
+	return true
+}
+
+// groupKey returns the key of the group the alert belongs to and the labels that form the group.
+func (n *notifier) groupKey(a alerting.Alert) (string, map[string]string) {
+	var labels map[string]string
+	parts := []string{a.Rule}
+	for _, name := range n.groupBy {
+		val := a.Labels[name]
+		if labels == nil {
+			labels = make(map[string]string, len(n.groupBy))
+		}
+		labels[name] = val
+		parts = append(parts, name+"="+val)
+	}
+	sort.Strings(parts[1:])
+	return strings.Join(parts, ","), labels
+}
+
+// alertKey identifies the alert of a rule for a single series.
+func alertKey(a alerting.Alert) string {
+	return a.Rule + "/" + metrics.SeriesKey(a.Metric, a.Labels)
+}
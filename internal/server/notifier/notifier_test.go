@@ -0,0 +1,223 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ulixes-bloom/ya-metrics/internal/server/alerting"
+	"github.com/ulixes-bloom/ya-metrics/internal/server/config"
+)
+
+// receiver records payloads posted to the webhook and responds with the queued status codes.
+type receiver struct {
+	payloads []Payload
+	codes    []int
+	mutex    sync.Mutex
+}
+
+func (r *receiver) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if len(r.codes) > 0 {
+		code := r.codes[0]
+		r.codes = r.codes[1:]
+		if code != http.StatusOK {
+			res.WriteHeader(code)
+			return
+		}
+	}
+
+	var p Payload
+	if err := json.NewDecoder(req.Body).Decode(&p); err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	r.payloads = append(r.payloads, p)
+}
+
+func (r *receiver) take() []Payload {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	res := r.payloads
+	r.payloads = nil
+	return res
+}
+
+func newAlert(host, state string) alerting.Alert {
+	return alerting.Alert{
+		Rule:   "HighCPU",
+		Metric: "CPUutilization1",
+		Labels: map[string]string{"host": host},
+		State:  state,
+	}
+}
+
+func TestNotify(t *testing.T) {
+	ctx := context.Background()
+	rcv := &receiver{}
+	ts := httptest.NewServer(rcv)
+	defer ts.Close()
+
+	conf := config.GetDefault()
+	conf.AlertWebhooks = ts.URL
+	conf.AlertGroupBy = "host"
+	conf.AlertRepeat = 60
+	n := New(conf)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	steps := []struct {
+		name   string
+		offset time.Duration
+		alerts []alerting.Alert
+		want   map[string]string // status of sent payloads by host
+	}{
+		{
+			name:   "Pending alerts are not sent",
+			alerts: []alerting.Alert{newAlert("a", alerting.StatePending)},
+			want:   map[string]string{},
+		},
+		{
+			name:   "Firing alerts are sent in groups",
+			offset: 10 * time.Second,
+			alerts: []alerting.Alert{newAlert("a", alerting.StateFiring), newAlert("b", alerting.StateFiring)},
+			want:   map[string]string{"a": alerting.StateFiring, "b": alerting.StateFiring},
+		},
+		{
+			name:   "Unchanged groups are not sent again",
+			offset: 20 * time.Second,
+			alerts: []alerting.Alert{newAlert("a", alerting.StateFiring), newAlert("b", alerting.StateFiring)},
+			want:   map[string]string{},
+		},
+		{
+			name:   "Resolved alerts are sent",
+			offset: 30 * time.Second,
+			alerts: []alerting.Alert{newAlert("a", alerting.StateResolved), newAlert("b", alerting.StateFiring)},
+			want:   map[string]string{"a": alerting.StateResolved},
+		},
+		{
+			name:   "Resolved alerts are sent once",
+			offset: 40 * time.Second,
+			alerts: []alerting.Alert{newAlert("a", alerting.StateResolved), newAlert("b", alerting.StateFiring)},
+			want:   map[string]string{},
+		},
+		{
+			name:   "Firing alerts are repeated",
+			offset: 80 * time.Second,
+			alerts: []alerting.Alert{newAlert("a", alerting.StateResolved), newAlert("b", alerting.StateFiring)},
+			want:   map[string]string{"b": alerting.StateFiring},
+		},
+		{
+			name:   "Firing alerts pending again are sent as resolved",
+			offset: 90 * time.Second,
+			alerts: []alerting.Alert{newAlert("b", alerting.StatePending)},
+			want:   map[string]string{"b": alerting.StateResolved},
+		},
+		{
+			name:   "Alerts of a new group are sent",
+			offset: 100 * time.Second,
+			alerts: []alerting.Alert{newAlert("c", alerting.StateFiring)},
+			want:   map[string]string{"c": alerting.StateFiring},
+		},
+		{
+			name:   "Firing alerts gone are sent as resolved",
+			offset: 110 * time.Second,
+			want:   map[string]string{"c": alerting.StateResolved},
+		},
+		{
+			name:   "Groups sent as resolved are forgotten",
+			offset: 120 * time.Second,
+			want:   map[string]string{},
+		},
+	}
+
+	for _, step := range steps {
+		require.NoError(t, n.Notify(ctx, start.Add(step.offset), step.alerts), step.name)
+
+		got := map[string]string{}
+		for _, p := range rcv.take() {
+			require.Len(t, p.Alerts, 1, step.name)
+			got[p.GroupLabels["host"]] = p.Status
+		}
+		assert.Equal(t, step.want, got, step.name)
+	}
+}
+
+func TestNotifyRetry(t *testing.T) {
+	ctx := context.Background()
+	rcv := &receiver{codes: []int{http.StatusServiceUnavailable, http.StatusOK, http.StatusBadRequest}}
+	ts := httptest.NewServer(rcv)
+	defer ts.Close()
+
+	conf := config.GetDefault()
+	conf.AlertWebhooks = ts.URL
+	n := New(conf)
+	now := time.Now()
+
+	// the first attempt fails with a server error and is retried
+	require.NoError(t, n.Notify(ctx, now, []alerting.Alert{newAlert("a", alerting.StateFiring)}))
+	assert.Len(t, rcv.take(), 1)
+
+	// client errors are not retried and the group is sent on the next call
+	require.Error(t, n.Notify(ctx, now, []alerting.Alert{newAlert("b", alerting.StateFiring)}))
+	assert.Empty(t, rcv.take())
+	require.NoError(t, n.Notify(ctx, now, []alerting.Alert{newAlert("b", alerting.StateFiring)}))
+	assert.Len(t, rcv.take(), 1)
+}
+
+func TestNotifyConcurrent(t *testing.T) {
+	ctx := context.Background()
+	release := make(chan struct{})
+	var hosts []string
+	var mutex sync.Mutex
+	ts := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		var p Payload
+		if err := json.NewDecoder(req.Body).Decode(&p); err != nil {
+			res.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if p.GroupLabels["host"] == "a" {
+			<-release
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		hosts = append(hosts, p.GroupLabels["host"])
+	}))
+	defer ts.Close()
+
+	conf := config.GetDefault()
+	conf.AlertWebhooks = ts.URL
+	conf.AlertGroupBy = "host"
+	n := New(conf)
+	now := time.Now()
+
+	// the receiver is slow for the group of a
+	done := make(chan error)
+	go func() {
+		done <- n.Notify(ctx, now, []alerting.Alert{newAlert("a", alerting.StateFiring)})
+	}()
+	require.Eventually(t, func() bool {
+		n.mutex.Lock()
+		defer n.mutex.Unlock()
+		g, ok := n.groups["HighCPU,host=a"]
+		return ok && g.sending
+	}, time.Second, 10*time.Millisecond)
+
+	// other groups are sent meanwhile, and the group being sent is not sent twice
+	alerts := []alerting.Alert{newAlert("a", alerting.StateFiring), newAlert("b", alerting.StateFiring)}
+	require.NoError(t, n.Notify(ctx, now, alerts))
+	close(release)
+	require.NoError(t, <-done)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Equal(t, []string{"b", "a"}, hosts)
+}
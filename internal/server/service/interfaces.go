@@ -2,8 +2,10 @@ package service
 
 import (
 	"context"
+	"time"
 
 	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+	"github.com/ulixes-bloom/ya-metrics/internal/server/alerting"
 )
 
 type (
@@ -11,16 +13,26 @@ type (
 		Getter
 		Setter
 
+		Ping(ctx context.Context) error
 		Shutdown(ctx context.Context) error
 	}
 
 	Getter interface {
-		Get(ctx context.Context, name string) (val metrics.Metric, err error)
+		Get(ctx context.Context, id string, labels map[string]string) (val metrics.Metric, err error)
 		GetAll(ctx context.Context) ([]metrics.Metric, error)
+		GetRange(ctx context.Context, id string, labels map[string]string, from, to time.Time) ([]metrics.Sample, error)
 	}
 
 	Setter interface {
 		Set(ctx context.Context, metric metrics.Metric) (metrics.Metric, error)
-		SetAll(ctx context.Context, meticsSlice []metrics.Metric) error
+		SetAll(ctx context.Context, meticsSlice []metrics.Metric) ([]metrics.Metric, error)
+	}
+
+	Watcher interface {
+		Subscribe() (<-chan metrics.Metric, func())
+	}
+
+	Alerts interface {
+		GetAlerts() []alerting.Alert
 	}
 )
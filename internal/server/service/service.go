@@ -6,23 +6,32 @@ import (
 	"encoding/json"
 	"fmt"
 	"html/template"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/ulixes-bloom/ya-metrics/internal/pkg/errors"
 	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
-	"github.com/ulixes-bloom/ya-metrics/internal/pkg/retry"
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/prometheus"
+	"github.com/ulixes-bloom/ya-metrics/internal/server/alerting"
 	"github.com/ulixes-bloom/ya-metrics/internal/server/config"
-	"github.com/ulixes-bloom/ya-metrics/internal/server/storage/pg"
 )
 
+// pingTimeout limits checking of the database connection.
+const pingTimeout = 3 * time.Second
+
 type service struct {
 	storage Storage
+	alerts  Alerts
 	conf    *config.Config
 }
 
-func New(storage Storage, conf *config.Config) *service {
+// New creates a service over the storage. Alerts may be nil if alerting is not used by the caller.
+func New(storage Storage, conf *config.Config, alerts Alerts) *service {
 	srv := &service{
 		storage: storage,
+		alerts:  alerts,
 		conf:    conf,
 	}
 
@@ -42,11 +51,8 @@ func (s *service) GetMetricsHTMLTable(ctx context.Context) ([]byte, error) {
 	metricsMap := map[string]string{}
 
 	for _, m := range allMetrics {
-		switch m.MType {
-		case metrics.Counter:
-			metricsMap[m.ID] = strconv.FormatInt(m.GetDelta(), 10)
-		case metrics.Gauge:
-			metricsMap[m.ID] = strconv.FormatFloat(m.GetValue(), 'f', -1, 64)
+		if val, ok := formatValue(m); ok {
+			metricsMap[m.Key()] = val
 		}
 	}
 
@@ -59,34 +65,153 @@ func (s *service) GetMetricsHTMLTable(ctx context.Context) ([]byte, error) {
 	return res, nil
 }
 
-func (s *service) GetMetric(ctx context.Context, mtype, mname string) ([]byte, error) {
-	var mval string
+func (s *service) GetMetricsPrometheus(ctx context.Context) ([]byte, error) {
+	allMetrics, err := s.storage.GetAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("service.getMetricsPrometheus: %w", err)
+	}
 
+	var wr bytes.Buffer
+	if err = prometheus.Encode(&wr, allMetrics); err != nil {
+		return nil, fmt.Errorf("service.getMetricsPrometheus: %w", err)
+	}
+	return wr.Bytes(), nil
+}
+
+// GetMetric returns the formatted value of the series, which must be of the type mtype.
+// A series of another type does not exist for the lookup.
+func (s *service) GetMetric(ctx context.Context, mtype, mname string, labels map[string]string) ([]byte, error) {
 	switch mtype {
-	case metrics.Gauge:
-		metric, err := s.storage.Get(ctx, mname)
+	case metrics.Gauge, metrics.Counter, metrics.Histogram, metrics.Summary:
+		metric, err := s.storage.Get(ctx, mname, labels)
 		if err != nil {
 			return nil, fmt.Errorf("service.getMetric: %w", err)
 		}
-		mval = strconv.FormatFloat(metric.GetValue(), 'f', -1, 64)
-	case metrics.Counter:
-		metric, err := s.storage.Get(ctx, mname)
-		if err != nil {
-			return nil, fmt.Errorf("service.getMetric: %w", err)
+		if metric.MType != mtype {
+			return nil, fmt.Errorf("service.getMetric: series '%s' of type '%s', %w", metric.Key(), metric.MType, errors.ErrMetricNotExists)
 		}
-		mval = strconv.FormatInt(metric.GetDelta(), 10)
+		mval, _ := formatValue(metric)
+		return []byte(mval), nil
 	default:
 		return nil, errors.ErrMetricTypeNotImplemented
 	}
+}
+
+// maxRangePoints limits the number of points a resampled range query may produce.
+const maxRangePoints = 11000
+
+// GetMetricRange returns the history of the series between from and to as JSON.
+// If step is positive, the history is resampled to points at from, from+step, ... up to to,
+// each holding the latest sample recorded within the preceding step.
+// Ranges of more than maxRangePoints steps are rejected with errors.ErrTooManyPoints.
+func (s *service) GetMetricRange(ctx context.Context, id string, labels map[string]string, from, to time.Time, step time.Duration) ([]byte, error) {
+	if step > 0 && to.Sub(from)/step > maxRangePoints {
+		return nil, fmt.Errorf("service.getMetricRange: %w", errors.ErrTooManyPoints)
+	}
+
+	samples, err := s.storage.GetRange(ctx, id, labels, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("service.getMetricRange: %w", err)
+	}
+	if step > 0 {
+		samples = resample(samples, from, to, step)
+	}
+
+	return json.Marshal(struct {
+		ID     string            `json:"id"`
+		Labels map[string]string `json:"labels,omitempty"`
+		Points []metrics.Sample  `json:"points"`
+	}{
+		ID:     id,
+		Labels: labels,
+		Points: samples,
+	})
+}
+
+// FindMetric returns the stored metric of the series.
+func (s *service) FindMetric(ctx context.Context, id string, labels map[string]string) (metrics.Metric, error) {
+	m, err := s.storage.Get(ctx, id, labels)
+	if err != nil {
+		return m, fmt.Errorf("service.findMetric: %w", err)
+	}
+	return m, nil
+}
+
+// ListMetrics returns metrics with the ID prefix and of the type ordered by series key.
+// Empty prefix and type match all metrics.
+func (s *service) ListMetrics(ctx context.Context, idPrefix, mtype string) ([]metrics.Metric, error) {
+	allMetrics, err := s.storage.GetAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("service.listMetrics: %w", err)
+	}
+
+	res := make([]metrics.Metric, 0, len(allMetrics))
+	for _, m := range allMetrics {
+		if matchMetric(m, idPrefix, mtype) {
+			res = append(res, m)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Key() < res[j].Key() })
+	return res, nil
+}
+
+// WatchMetrics returns a channel receiving metrics with the ID prefix and of the type as they are written
+// to the storage. The channel is closed when the context is done.
+func (s *service) WatchMetrics(ctx context.Context, idPrefix, mtype string) (<-chan metrics.Metric, error) {
+	w, ok := s.storage.(Watcher)
+	if !ok {
+		return nil, errors.ErrWatchNotSupported
+	}
+
+	updates, cancel := w.Subscribe()
+	res := make(chan metrics.Metric)
+	go func() {
+		defer close(res)
+		defer cancel()
+
+		for {
+			select {
+			case m := <-updates:
+				if !matchMetric(m, idPrefix, mtype) {
+					continue
+				}
+				select {
+				case res <- m:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return res, nil
+}
+
+func matchMetric(m metrics.Metric, idPrefix, mtype string) bool {
+	return strings.HasPrefix(m.ID, idPrefix) && (mtype == "" || m.MType == mtype)
+}
+
+func (s *service) GetAlerts(ctx context.Context) ([]byte, error) {
+	alerts := []alerting.Alert{}
+	if s.alerts != nil {
+		alerts = s.alerts.GetAlerts()
+	}
 
-	return []byte(mval), nil
+	res, err := json.Marshal(alerts)
+	if err != nil {
+		return nil, fmt.Errorf("service.getAlerts: %w", err)
+	}
+	return res, nil
 }
 
-func (s *service) UpdateMetric(ctx context.Context, mtype, mname, mval string) error {
+func (s *service) UpdateMetric(ctx context.Context, mtype, mname, mval string, labels map[string]string) error {
 	switch mtype {
 	case metrics.Gauge:
 		if val, err := strconv.ParseFloat(mval, 64); err == nil {
-			_, err := s.storage.Set(ctx, metrics.NewGaugeMetric(mname, val))
+			metric := metrics.NewGaugeMetric(mname, val)
+			metric.Labels = labels
+			_, err := s.storage.Set(ctx, metric)
 			if err != nil {
 				return fmt.Errorf("service.updateMetric.parseGauge: %w", err)
 			}
@@ -95,7 +220,9 @@ func (s *service) UpdateMetric(ctx context.Context, mtype, mname, mval string) e
 		}
 	case metrics.Counter:
 		if val, err := strconv.ParseInt(mval, 10, 64); err == nil {
-			_, err := s.storage.Set(ctx, metrics.NewCounterMetric(mname, val))
+			metric := metrics.NewCounterMetric(mname, val)
+			metric.Labels = labels
+			_, err := s.storage.Set(ctx, metric)
 			if err != nil {
 				return fmt.Errorf("service.updateMetric.parseCounter: %w", err)
 			}
@@ -110,18 +237,14 @@ func (s *service) UpdateMetric(ctx context.Context, mtype, mname, mval string) e
 }
 
 func (s *service) UpdateMetrics(ctx context.Context, metricsSlice []metrics.Metric) error {
-	for _, m := range metricsSlice {
-		_, err := s.UpdateJSONMetric(ctx, m)
-
-		if err != nil {
-			return fmt.Errorf("service.updateMetrics: %w", err)
-		}
+	if _, err := s.storage.SetAll(ctx, metricsSlice); err != nil {
+		return fmt.Errorf("service.updateMetrics: %w", err)
 	}
 	return nil
 }
 
 func (s *service) GetJSONMetric(ctx context.Context, metric metrics.Metric) ([]byte, error) {
-	val, err := s.storage.Get(ctx, metric.ID)
+	val, err := s.storage.Get(ctx, metric.ID, metric.Labels)
 	if err != nil {
 		return nil, fmt.Errorf("service.getJSONMetric: %w", err)
 	}
@@ -141,11 +264,58 @@ func (s *service) Shutdown(ctx context.Context) error {
 	return s.storage.Shutdown(ctx)
 }
 
-func (s *service) PingDB(dsn string) error {
-	err := retry.Do(func() error { return pg.PingDB(dsn) }, pg.NeedToRetry(), 4)
-	if err != nil {
+// PingDB checks the database of the storage is reachable within pingTimeout.
+func (s *service) PingDB(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+
+	if err := s.storage.Ping(ctx); err != nil {
 		return fmt.Errorf("service.pingDB: %w", err)
 	}
-
 	return nil
 }
+
+// formatValue returns the text representation of the metric value used on the HTML page and in /value/ responses.
+// Histograms and summaries are rendered as count, sum and their buckets or quantiles,
+// e.g. "count=3 sum=1.5 buckets=[0.5:1 1:3]".
+func formatValue(m metrics.Metric) (string, bool) {
+	switch m.MType {
+	case metrics.Counter:
+		return strconv.FormatInt(m.GetDelta(), 10), true
+	case metrics.Gauge:
+		return strconv.FormatFloat(m.GetValue(), 'f', -1, 64), true
+	case metrics.Histogram:
+		parts := make([]string, 0, len(m.Buckets))
+		for _, b := range m.Buckets {
+			parts = append(parts, strconv.FormatFloat(b.UpperBound, 'f', -1, 64)+":"+strconv.FormatUint(b.Count, 10))
+		}
+		return fmt.Sprintf("count=%d sum=%s buckets=[%s]",
+			m.GetCount(), strconv.FormatFloat(m.GetSum(), 'f', -1, 64), strings.Join(parts, " ")), true
+	case metrics.Summary:
+		parts := make([]string, 0, len(m.Quantiles))
+		for _, q := range m.Quantiles {
+			parts = append(parts, strconv.FormatFloat(q.Quantile, 'f', -1, 64)+":"+strconv.FormatFloat(q.Value, 'f', -1, 64))
+		}
+		return fmt.Sprintf("count=%d sum=%s quantiles=[%s]",
+			m.GetCount(), strconv.FormatFloat(m.GetSum(), 'f', -1, 64), strings.Join(parts, " ")), true
+	default:
+		return "", false
+	}
+}
+
+// resample converts samples ordered by time to points evenly spaced by step.
+// Each point takes the value of the latest sample in (t-step, t], points without samples are skipped.
+func resample(samples []metrics.Sample, from, to time.Time, step time.Duration) []metrics.Sample {
+	points := []metrics.Sample{}
+	i := 0
+	for t := from; !t.After(to); t = t.Add(step) {
+		var last *metrics.Sample
+		for ; i < len(samples) && !samples[i].Timestamp.After(t); i++ {
+			last = &samples[i]
+		}
+		if last != nil && last.Timestamp.After(t.Add(-step)) {
+			points = append(points, metrics.Sample{Timestamp: t, Value: last.Value})
+		}
+	}
+	return points
+}
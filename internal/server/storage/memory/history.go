@@ -0,0 +1,132 @@
+package memory
+
+import (
+	"time"
+
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+	"github.com/ulixes-bloom/ya-metrics/internal/server/config"
+)
+
+// history keeps the samples of a single series: the latest raw samples in a fixed size ring buffer
+// and their averages, downsampled by the compactor for every rollup level of the retention policy.
+type history struct {
+	raw     *ring
+	rollups [][]metrics.Sample // rollups[i] holds samples of policy level i+1, ordered by time
+}
+
+func newHistory(size int, policy config.RetentionPolicy) *history {
+	return &history{
+		raw:     newRing(size),
+		rollups: make([][]metrics.Sample, len(policy)-1),
+	}
+}
+
+// level returns samples of the policy level with timestamps in [from, to] ordered by time.
+func (h *history) level(i int, from, to time.Time) []metrics.Sample {
+	samples := h.raw.ordered()
+	if i > 0 {
+		samples = h.rollups[i-1]
+	}
+
+	res := []metrics.Sample{}
+	for _, s := range samples {
+		if !s.Timestamp.Before(from) && !s.Timestamp.After(to) {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// compact recomputes the averages of every rollup level for buckets in [windowStart, now)
+// from the preceding finer level, then drops samples that are older than their level period.
+func (h *history) compact(policy config.RetentionPolicy, now time.Time, interval time.Duration) {
+	for i := 1; i < len(policy); i++ {
+		resolution := policy[i].Resolution
+		windowStart := now.Add(-interval - resolution).Truncate(resolution)
+		windowEnd := now.Truncate(resolution)
+
+		source := h.level(i-1, windowStart, windowEnd.Add(-time.Nanosecond))
+		rollup := h.rollups[i-1]
+		for len(rollup) > 0 && !rollup[len(rollup)-1].Timestamp.Before(windowStart) {
+			rollup = rollup[:len(rollup)-1]
+		}
+		h.rollups[i-1] = append(rollup, downsample(source, resolution)...)
+	}
+
+	for i, l := range policy {
+		if l.Period == 0 {
+			continue
+		}
+		expired := now.Add(-l.Period)
+		if i == 0 {
+			h.raw.trim(expired)
+			continue
+		}
+		rollup := h.rollups[i-1]
+		n := 0
+		for n < len(rollup) && rollup[n].Timestamp.Before(expired) {
+			n++
+		}
+		h.rollups[i-1] = rollup[n:]
+	}
+}
+
+// downsample averages samples ordered by time into buckets of the given resolution.
+// Every resulting sample is stamped with the start of its bucket.
+func downsample(samples []metrics.Sample, resolution time.Duration) []metrics.Sample {
+	res := []metrics.Sample{}
+	var sum float64
+	var count int
+	for i, s := range samples {
+		sum += s.Value
+		count++
+
+		bucket := s.Timestamp.Truncate(resolution)
+		if i == len(samples)-1 || !samples[i+1].Timestamp.Truncate(resolution).Equal(bucket) {
+			res = append(res, metrics.Sample{Timestamp: bucket, Value: sum / float64(count)})
+			sum, count = 0, 0
+		}
+	}
+	return res
+}
+
+// ring is a fixed size ring buffer of samples ordered by time.
+// Once the buffer is full, new samples overwrite the oldest ones.
+type ring struct {
+	samples []metrics.Sample
+	start   int // position of the oldest sample
+	size    int // number of stored samples
+}
+
+func newRing(capacity int) *ring {
+	return &ring{
+		samples: make([]metrics.Sample, capacity),
+	}
+}
+
+// add appends the sample to the buffer.
+func (r *ring) add(sample metrics.Sample) {
+	r.samples[(r.start+r.size)%len(r.samples)] = sample
+	if r.size < len(r.samples) {
+		r.size++
+	} else {
+		r.start = (r.start + 1) % len(r.samples)
+	}
+}
+
+// trim drops samples older than the given time.
+func (r *ring) trim(before time.Time) {
+	for r.size > 0 && r.samples[r.start].Timestamp.Before(before) {
+		r.start = (r.start + 1) % len(r.samples)
+		r.size--
+	}
+}
+
+// ordered returns stored samples from the oldest to the newest.
+func (r *ring) ordered() []metrics.Sample {
+	res := make([]metrics.Sample, 0, r.size)
+	for i := 0; i < r.size; i++ {
+		res = append(res, r.samples[(r.start+i)%len(r.samples)])
+	}
+	return res
+}
@@ -0,0 +1,69 @@
+package memory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+	"github.com/ulixes-bloom/ya-metrics/internal/server/config"
+)
+
+func TestRing(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := newRing(3)
+	for i := range 5 {
+		r.add(metrics.Sample{Timestamp: start.Add(time.Duration(i) * time.Second), Value: float64(i)})
+	}
+
+	samples := r.ordered()
+	require.Len(t, samples, 3)
+	assert.Equal(t, float64(2), samples[0].Value)
+	assert.Equal(t, float64(4), samples[2].Value)
+
+	r.trim(start.Add(4 * time.Second))
+	samples = r.ordered()
+	require.Len(t, samples, 1)
+	assert.Equal(t, float64(4), samples[0].Value)
+}
+
+func TestHistoryCompact(t *testing.T) {
+	conf := config.GetDefault()
+	conf.Retention = "raw:2m,1m:10m,5m:1h"
+	policy, err := conf.GetRetentionPolicy()
+	require.NoError(t, err)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	h := newHistory(100, policy)
+
+	// one sample every 10 seconds during 5 minutes, with value equal to the minute
+	for i := range 30 {
+		ts := start.Add(time.Duration(i) * 10 * time.Second)
+		h.raw.add(metrics.Sample{Timestamp: ts, Value: float64(i / 6)})
+		if ts.Second() == 0 {
+			h.compact(policy, ts, time.Minute)
+		}
+	}
+	now := start.Add(5 * time.Minute)
+	h.compact(policy, now, time.Minute)
+
+	raw := h.level(0, start, now)
+	assert.Len(t, raw, 12, "raw samples older than 2m are expired")
+
+	minutes := h.level(1, start, now)
+	require.Len(t, minutes, 5)
+	for i, s := range minutes {
+		assert.Equal(t, start.Add(time.Duration(i)*time.Minute), s.Timestamp)
+		assert.Equal(t, float64(i), s.Value)
+	}
+
+	fiveMinutes := h.level(2, start, now)
+	require.Len(t, fiveMinutes, 1)
+	assert.Equal(t, start, fiveMinutes[0].Timestamp)
+	assert.Equal(t, float64(2), fiveMinutes[0].Value)
+
+	assert.Equal(t, 0, policy.LevelFor(time.Minute))
+	assert.Equal(t, 1, policy.LevelFor(5*time.Minute))
+	assert.Equal(t, 2, policy.LevelFor(24*time.Hour))
+}
@@ -1,12 +1,9 @@
 package memory
 
 import (
-	"bufio"
 	"context"
-	"encoding/json"
-	"errors"
 	"fmt"
-	"os"
+	"hash/fnv"
 	"sync"
 	"time"
 
@@ -16,23 +13,52 @@ import (
 	"github.com/ulixes-bloom/ya-metrics/internal/server/config"
 )
 
-type memstorage struct {
+// shardCount is the number of independently locked shards the series are spread over.
+const shardCount = 64
+
+// shard holds the series whose keys hash to it.
+type shard struct {
 	metrics map[string]metrics.Metric
-	conf    *config.Config
+	history map[string]*history // latest samples of every series, if conf.HistoryEnabled is set
 	mutex   sync.RWMutex
 }
 
+// memstorage spreads series over shards by the hash of the series key, so updates
+// of different series rarely contend for a lock. Snapshots are written from a copy
+// of the shards and do not block updates while the file is written.
+type memstorage struct {
+	shards  [shardCount]*shard
+	policy  config.RetentionPolicy
+	wal     *wal // log of updates, if conf.StoreInterval is set to 0
+	conf    *config.Config
+	persist sync.Mutex // serializes writing of snapshots
+
+	shutdown    sync.Once
+	shutdownErr error
+}
+
 func NewStorage(ctx context.Context, conf *config.Config) (*memstorage, error) {
+	policy, err := conf.GetRetentionPolicy()
+	if err != nil {
+		return nil, fmt.Errorf("memory.newStorage: %w", err)
+	}
+
 	ms := memstorage{
-		conf: conf,
+		policy: policy,
+		conf:   conf,
+	}
+	for i := range ms.shards {
+		ms.shards[i] = &shard{
+			// pre-allocate the metrics map with the expected size
+			metrics: make(map[string]metrics.Metric, metrics.MetricsCount/shardCount+1),
+			history: make(map[string]*history),
+		}
 	}
-	// pre-allocate the metrics map with the expected size
-	ms.metrics = make(map[string]metrics.Metric, metrics.MetricsCount)
 
 	// initialize Gauge metrics with a default value of 0
 	for _, g := range metrics.GaugeMetrics {
 		zeroVal := float64(0)
-		ms.metrics[g] = metrics.Metric{
+		ms.shardFor(g).metrics[g] = metrics.Metric{
 			ID:    g,
 			MType: metrics.Gauge,
 			Value: &zeroVal,
@@ -42,14 +68,14 @@ func NewStorage(ctx context.Context, conf *config.Config) (*memstorage, error) {
 	// initialize Counter metrics with a default value of 0
 	for _, c := range metrics.CounterMetrics {
 		zeroVal := int64(0)
-		ms.metrics[c] = metrics.Metric{
+		ms.shardFor(c).metrics[c] = metrics.Metric{
 			ID:    c,
 			MType: metrics.Counter,
 			Delta: &zeroVal,
 		}
 	}
 
-	err := ms.setup(ctx)
+	err = ms.setup(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("memory.newStorage.setup: %w", err)
 	}
@@ -58,86 +84,336 @@ func NewStorage(ctx context.Context, conf *config.Config) (*memstorage, error) {
 }
 
 func (ms *memstorage) Set(ctx context.Context, metric metrics.Metric) (metrics.Metric, error) {
-	ms.mutex.Lock()
-	defer ms.mutex.Unlock()
+	key := metric.Key()
+	sh := ms.shardFor(key)
+	sh.mutex.Lock()
+	defer sh.mutex.Unlock()
+
+	cur, exists := sh.metrics[key]
+	metric, err := merge(key, cur, exists, metric)
+	if err != nil {
+		return metric, fmt.Errorf("memory.set: %w", err)
+	}
+
+	if err := ms.sync(ctx, metric); err != nil {
+		return metric, fmt.Errorf("memory.set: %w", err)
+	}
+	ms.store(sh, key, metric)
+	return metric, nil
+}
+
+// SetAll stores the metrics holding the write locks of all their shards,
+// so the batch is logged at once and readers see either none or all of it.
+// It returns the stored state of the series after every update of the batch.
+// The batch is merged aside first: if any metric can't be merged into its series, e.g. as it is
+// of another type or has other histogram buckets, nothing of the batch is logged or stored.
+func (ms *memstorage) SetAll(ctx context.Context, metricsSlice []metrics.Metric) ([]metrics.Metric, error) {
+	unlock := ms.lockShards(metricsSlice)
+	defer unlock()
+
+	staged := make(map[string]metrics.Metric, len(metricsSlice))
+	stored := make([]metrics.Metric, 0, len(metricsSlice))
+	for _, m := range metricsSlice {
+		key := m.Key()
+		cur, exists := staged[key]
+		if !exists {
+			cur, exists = ms.shardFor(key).metrics[key]
+		}
+		merged, err := merge(key, cur, exists, m)
+		if err != nil {
+			return nil, fmt.Errorf("memory.setAll: %w", err)
+		}
+		staged[key] = merged
+		stored = append(stored, merged)
+	}
+
+	if err := ms.sync(ctx, stored...); err != nil {
+		return nil, fmt.Errorf("memory.setAll: %w", err)
+	}
+	for _, m := range stored {
+		key := m.Key()
+		ms.store(ms.shardFor(key), key, m)
+	}
+	return stored, nil
+}
+
+// merge returns the state of the series after the update with the metric, cur is its current state
+// if it exists. The metric must be of the type of the series.
+func merge(key string, cur metrics.Metric, exists bool, metric metrics.Metric) (metrics.Metric, error) {
+	if exists && cur.MType != metric.MType {
+		return metric, fmt.Errorf("memory.merge: series '%s', %w", key, appErrors.ErrMetricTypeMismatch)
+	}
 
 	switch metric.MType {
 	case metrics.Counter:
-		cur, exists := ms.metrics[metric.ID]
 		if exists {
 			newDelta := metric.GetDelta() + cur.GetDelta()
 			metric.Delta = &newDelta
 		}
-		ms.metrics[metric.ID] = metric
+		return metric, nil
 	case metrics.Gauge:
-		ms.metrics[metric.ID] = metric
+		return metric, nil
+	case metrics.Histogram:
+		merged, err := metrics.MergeHistogram(cur, metric)
+		if err != nil {
+			return metric, fmt.Errorf("memory.merge: %w", err)
+		}
+		return merged, nil
+	case metrics.Summary:
+		merged, err := metrics.MergeSummary(cur, metric)
+		if err != nil {
+			return metric, fmt.Errorf("memory.merge: %w", err)
+		}
+		return merged, nil
 	default:
 		return metric, appErrors.ErrMetricTypeNotImplemented
 	}
+}
 
-	if err := ms.sync(ctx); err != nil {
-		return metric, fmt.Errorf("memory.set: %w", err)
+// store sets the state of the series and records it in the history.
+// Must be called with the write lock of the shard held.
+func (ms *memstorage) store(sh *shard, key string, metric metrics.Metric) {
+	sh.metrics[key] = metric
+	ms.addSample(sh, key, metric)
+}
+
+func (ms *memstorage) Get(ctx context.Context, id string, labels map[string]string) (metrics.Metric, error) {
+	key := metrics.SeriesKey(id, labels)
+	sh := ms.shardFor(key)
+	sh.mutex.RLock()
+	defer sh.mutex.RUnlock()
+
+	metric, exists := sh.metrics[key]
+	if !exists {
+		return metric, appErrors.ErrMetricNotExists
 	}
 	return metric, nil
 }
 
-func (ms *memstorage) SetAll(ctx context.Context, metricsSlice []metrics.Metric) error {
-	for _, m := range metricsSlice {
-		if _, err := ms.Set(ctx, m); err != nil {
-			return fmt.Errorf("memory.setAll.set: %w", err)
-		}
+// GetRange returns the history samples of the series recorded between from and to.
+// Samples are read from the finest retention level that still keeps samples as old as from.
+func (ms *memstorage) GetRange(ctx context.Context, id string, labels map[string]string, from, to time.Time) ([]metrics.Sample, error) {
+	if !ms.conf.HistoryEnabled {
+		return nil, appErrors.ErrHistoryNotEnabled
 	}
 
-	if err := ms.sync(ctx); err != nil {
-		return fmt.Errorf("memory.setAll: %w", err)
+	key := metrics.SeriesKey(id, labels)
+	sh := ms.shardFor(key)
+	sh.mutex.RLock()
+	defer sh.mutex.RUnlock()
+
+	h, exists := sh.history[key]
+	if !exists {
+		return []metrics.Sample{}, nil
 	}
-	return nil
+	return h.level(ms.policy.LevelFor(time.Since(from)), from, to), nil
 }
 
-func (ms *memstorage) Get(ctx context.Context, name string) (metrics.Metric, error) {
-	ms.mutex.RLock()
-	defer ms.mutex.RUnlock()
+// GetAll returns all series. Shards are read one by one,
+// so the result is not a consistent view of concurrent updates of different shards.
+func (ms *memstorage) GetAll(ctx context.Context) ([]metrics.Metric, error) {
+	allMetrics := make([]metrics.Metric, 0, metrics.MetricsCount)
+	for _, sh := range ms.shards {
+		sh.mutex.RLock()
+		for _, m := range sh.metrics {
+			allMetrics = append(allMetrics, m)
+		}
+		sh.mutex.RUnlock()
+	}
+	return allMetrics, nil
+}
 
-	metric, exists := ms.metrics[name]
+// addSample appends the current value of the series to its history if conf.HistoryEnabled is set.
+// Must be called with the write lock of the shard held.
+func (ms *memstorage) addSample(sh *shard, key string, metric metrics.Metric) {
+	if !ms.conf.HistoryEnabled {
+		return
+	}
+
+	h, exists := sh.history[key]
 	if !exists {
-		return metric, appErrors.ErrMetricNotExists
+		h = newHistory(ms.conf.HistorySize, ms.policy)
+		sh.history[key] = h
 	}
-	return metric, nil
+	h.raw.add(metrics.Sample{Timestamp: time.Now(), Value: metric.SampleValue()})
 }
 
-func (ms *memstorage) GetAll(ctx context.Context) ([]metrics.Metric, error) {
-	ms.mutex.RLock()
-	defer ms.mutex.RUnlock()
+func (ms *memstorage) shardFor(key string) *shard {
+	return ms.shards[shardIndex(key)]
+}
+
+// shardIndex returns the index of the shard of the series key, the FNV-1a hash of the key modulo shardCount.
+func shardIndex(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % shardCount)
+}
 
-	allMetrics := make([]metrics.Metric, 0, len(ms.metrics))
-	for _, m := range ms.metrics {
-		allMetrics = append(allMetrics, m)
+// lockShards takes the write locks of the shards of the metrics and returns the function releasing them.
+// Locks are taken in the order of shard indexes to avoid deadlocks between concurrent batches.
+func (ms *memstorage) lockShards(metricsSlice []metrics.Metric) func() {
+	var locked [shardCount]bool
+	for _, m := range metricsSlice {
+		locked[shardIndex(m.Key())] = true
+	}
+
+	indexes := make([]int, 0, len(metricsSlice))
+	for i, ok := range locked {
+		if ok {
+			indexes = append(indexes, i)
+		}
+	}
+	for _, i := range indexes {
+		ms.shards[i].mutex.Lock()
+	}
+
+	return func() {
+		for _, i := range indexes {
+			ms.shards[i].mutex.Unlock()
+		}
 	}
-	return allMetrics, nil
 }
 
-func (ms *memstorage) setup(ctx context.Context) error {
-	ms.mutex.Lock()
-	defer ms.mutex.Unlock()
+// copyMetrics returns a copy of all series by series key, reading every shard under its read lock.
+func (ms *memstorage) copyMetrics() map[string]metrics.Metric {
+	res := make(map[string]metrics.Metric, metrics.MetricsCount)
+	for _, sh := range ms.shards {
+		sh.mutex.RLock()
+		for key, m := range sh.metrics {
+			res[key] = m
+		}
+		sh.mutex.RUnlock()
+	}
+	return res
+}
 
+func (ms *memstorage) setup(ctx context.Context) error {
 	if ms.conf.Restore {
 		// Restore metrics values from file
 		if err := ms.restoreMetricsFromFile(); err != nil {
 			return fmt.Errorf("memory.setup: %w", err)
 		}
 	}
+	if err := ms.setupWAL(); err != nil {
+		return fmt.Errorf("memory.setup: %w", err)
+	}
 
 	ms.async(ctx)
+	ms.startCompactor(ctx)
 	return nil
 }
 
+// Ping reports appErrors.ErrDatabaseNotUsed, the storage keeps metrics in memory.
+func (ms *memstorage) Ping(ctx context.Context) error {
+	return appErrors.ErrDatabaseNotUsed
+}
+
+// Shutdown persists the metrics. Only the first call has an effect, as the servers
+// of all protocols shut the storage down on exit.
+// In the WAL mode the log is closed and removed once the snapshot is written.
 func (ms *memstorage) Shutdown(ctx context.Context) error {
-	return ms.saveMetricsToFile(ctx)
+	ms.shutdown.Do(func() {
+		if ms.wal != nil {
+			ms.shutdownErr = ms.compactWAL(true)
+		} else {
+			ms.shutdownErr = ms.saveMetricsToFile()
+		}
+		if ms.shutdownErr != nil {
+			ms.shutdownErr = fmt.Errorf("memory.shutdown: %w", ms.shutdownErr)
+		}
+	})
+	return ms.shutdownErr
+}
+
+// setupWAL opens the write-ahead log if config.StoreInterval is set to 0.
+// The segments of the previous run are removed after a new snapshot of the current metrics is written,
+// also when the storage is not in the WAL mode anymore. Their updates are part of the snapshot
+// if config.Restore is set, otherwise nothing is restored and the log of the previous run is discarded.
+func (ms *memstorage) setupWAL() error {
+	walPath := ms.walPath()
+	segments, err := walSegments(walPath)
+	if err != nil {
+		return fmt.Errorf("memory.setupWAL: %w", err)
+	}
+	if ms.conf.StoreInterval != 0 && len(segments) == 0 {
+		return nil
+	}
+
+	if err := ms.saveMetricsToFile(); err != nil {
+		return fmt.Errorf("memory.setupWAL: %w", err)
+	}
+	// continue the numbering of the previous run, so a segment failing to be removed
+	// is never mistaken for a newer one
+	var next uint64
+	if len(segments) > 0 {
+		next = segments[len(segments)-1] + 1
+	}
+	if err := removeWALSegments(walPath, next); err != nil {
+		return fmt.Errorf("memory.setupWAL: %w", err)
+	}
+	if ms.conf.StoreInterval != 0 {
+		return nil
+	}
+
+	w, err := openWAL(walPath, next)
+	if err != nil {
+		return fmt.Errorf("memory.setupWAL: %w", err)
+	}
+	ms.wal = w
+	return nil
 }
 
-// start a background process to save metrics to a file with period conf.StoreInterval
+// compactWAL writes the snapshot of all metrics and drops the logged updates it includes.
+//
+// Updates are blocked only while the metrics are copied and the log switches to a new segment,
+// so the copy includes exactly the updates logged to the previous segments.
+// Those are removed once the snapshot is written. If final is set, the log is closed
+// instead of switching to a new segment and all its segments are removed.
+func (ms *memstorage) compactWAL(final bool) error {
+	ms.persist.Lock()
+	defer ms.persist.Unlock()
+
+	for _, sh := range ms.shards {
+		sh.mutex.Lock()
+	}
+	data := make(map[string]metrics.Metric, metrics.MetricsCount)
+	for _, sh := range ms.shards {
+		for key, m := range sh.metrics {
+			data[key] = m
+		}
+	}
+	var seq uint64
+	var err error
+	if final {
+		seq, err = ms.wal.close()
+	} else {
+		seq, err = ms.wal.rotate()
+	}
+	for _, sh := range ms.shards {
+		sh.mutex.Unlock()
+	}
+	if err != nil {
+		return fmt.Errorf("memory.compactWAL: %w", err)
+	}
+
+	if err := writeSnapshot(ms.conf.FileStoragePath, ms.conf.SnapshotKeep, data); err != nil {
+		return fmt.Errorf("memory.compactWAL: %w", err)
+	}
+	if err := removeWALSegments(ms.walPath(), seq); err != nil {
+		return fmt.Errorf("memory.compactWAL: %w", err)
+	}
+	return nil
+}
+
+func (ms *memstorage) walPath() string {
+	return ms.conf.FileStoragePath + ".wal"
+}
+
+// start a background process to save metrics to a file with period conf.StoreInterval,
+// or to compact the write-ahead log with period conf.WALCompactInterval if conf.StoreInterval is set to 0.
 func (ms *memstorage) async(ctx context.Context) {
 	if ms.conf.StoreInterval == 0 {
+		ms.startWALCompactor(ctx)
 		return
 	}
 	storeTicker := time.NewTicker(ms.conf.GetStoreIntervalDuration())
@@ -145,58 +421,107 @@ func (ms *memstorage) async(ctx context.Context) {
 	go func() {
 		for {
 			<-storeTicker.C
-			if err := ms.saveMetricsToFile(ctx); err != nil {
-				log.Err(err)
+			if err := ms.saveMetricsToFile(); err != nil {
+				log.Error().Msg(err.Error())
 			}
 		}
 	}()
 }
 
-// persist metrics values to a file if config.StoreInterval is set to 0.
-func (ms *memstorage) sync(ctx context.Context) error {
-	if ms.conf.StoreInterval == 0 {
-		if err := ms.saveMetricsToFile(ctx); err != nil {
-			return fmt.Errorf("memory.sync: %w", err)
+func (ms *memstorage) startWALCompactor(ctx context.Context) {
+	compactTicker := time.NewTicker(ms.conf.GetWALCompactIntervalDuration())
+
+	go func() {
+		defer compactTicker.Stop()
+		for {
+			select {
+			case <-compactTicker.C:
+				if err := ms.compactWAL(false); err != nil {
+					log.Error().Msg(err.Error())
+				}
+			case <-ctx.Done():
+				return
+			}
 		}
+	}()
+}
+
+// start a background process to downsample and expire history samples with period conf.CompactInterval
+func (ms *memstorage) startCompactor(ctx context.Context) {
+	if !ms.conf.HistoryEnabled {
+		return
+	}
+	compactTicker := time.NewTicker(ms.conf.GetCompactIntervalDuration())
+
+	go func() {
+		defer compactTicker.Stop()
+		for {
+			select {
+			case now := <-compactTicker.C:
+				ms.compact(now)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// compact applies the retention policy to the history of every series.
+func (ms *memstorage) compact(now time.Time) {
+	for _, sh := range ms.shards {
+		sh.mutex.Lock()
+		for _, h := range sh.history {
+			h.compact(ms.policy, now, ms.conf.GetCompactIntervalDuration())
+		}
+		sh.mutex.Unlock()
+	}
+}
+
+// persist the stored metrics to the write-ahead log if config.StoreInterval is set to 0.
+// Must be called with the write locks of the shards of the metrics held.
+func (ms *memstorage) sync(ctx context.Context, stored ...metrics.Metric) error {
+	if ms.wal == nil || len(stored) == 0 {
+		return nil
+	}
+	if err := ms.wal.append(stored...); err != nil {
+		return fmt.Errorf("memory.sync: %w", err)
 	}
 	return nil
 }
 
-// load metrics from the file into memory.
+// load metrics from the newest valid snapshot of the file into memory
+// and replay the updates of the write-ahead log over them.
+// Must be called before the storage is used.
 func (ms *memstorage) restoreMetricsFromFile() error {
-	file, err := os.OpenFile(ms.conf.FileStoragePath, os.O_RDONLY, 0644)
+	restoredMetrics, err := restoreSnapshot(ms.conf.FileStoragePath, ms.conf.SnapshotKeep)
 	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			return nil
-		}
-		return fmt.Errorf("memory.restoreMetricsFromFile.openFile: '%s', %w", ms.conf.FileStoragePath, err)
+		return fmt.Errorf("memory.restoreMetricsFromFile: %w", err)
 	}
-	defer func() {
-		if err = file.Close(); err != nil {
-			log.Debug().Msgf("memory.restoreMetricsFromFile: failed to close file '%s'", ms.conf.FileStoragePath)
+	if restoredMetrics != nil {
+		for _, sh := range ms.shards {
+			clear(sh.metrics)
 		}
-	}()
+		for key, m := range restoredMetrics {
+			ms.shardFor(key).metrics[key] = m
+		}
+	}
 
-	restoredMetrics := make(map[string]metrics.Metric)
-	if err = json.NewDecoder(file).Decode(&restoredMetrics); err != nil {
-		return fmt.Errorf("memory.restoreMetricsFromFile.decode: %w", err)
+	err = replayWAL(ms.walPath(), func(m metrics.Metric) {
+		ms.shardFor(m.Key()).metrics[m.Key()] = m
+	})
+	if err != nil {
+		return fmt.Errorf("memory.restoreMetricsFromFile: %w", err)
 	}
-	ms.metrics = restoredMetrics
 	return nil
 }
 
-// write metrics from memory to the file specified in config.FileStoragePath
-func (ms *memstorage) saveMetricsToFile(ctx context.Context) error {
-	file, err := os.OpenFile(ms.conf.FileStoragePath, os.O_WRONLY|os.O_CREATE, 0644)
-	if err != nil {
-		return fmt.Errorf("memory.saveMetricsToFile.openFile: '%s', %w", ms.conf.FileStoragePath, err)
-	}
-	defer file.Close()
+// write a copy of metrics from memory to the file specified in config.FileStoragePath.
+func (ms *memstorage) saveMetricsToFile() error {
+	ms.persist.Lock()
+	defer ms.persist.Unlock()
 
-	writer := bufio.NewWriter(file)
-	encoder := json.NewEncoder(writer)
-	if err := encoder.Encode(ms.metrics); err != nil {
-		return fmt.Errorf("memory.saveMetricsToFile.encode: %w", err)
+	if err := writeSnapshot(ms.conf.FileStoragePath, ms.conf.SnapshotKeep, ms.copyMetrics()); err != nil {
+		return fmt.Errorf("memory.saveMetricsToFile: %w", err)
 	}
-	return writer.Flush()
+	return nil
 }
@@ -2,11 +2,16 @@ package memory
 
 import (
 	"context"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/require"
 	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
 	"github.com/ulixes-bloom/ya-metrics/internal/server/config"
+	"github.com/ulixes-bloom/ya-metrics/internal/server/storage/storagetest"
 )
 
 var (
@@ -15,6 +20,19 @@ var (
 	contextTimeout = 30 * time.Second
 )
 
+func TestConformance(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), contextTimeout)
+	defer cancel()
+
+	conf := config.GetDefault()
+	conf.Restore = false
+	conf.FileStoragePath = filepath.Join(t.TempDir(), "metrics.json")
+	s, err := NewStorage(ctx, conf)
+	require.NoError(t, err)
+
+	storagetest.Run(t, s)
+}
+
 func BenchmarkSet(b *testing.B) {
 	ctx, cancel := context.WithTimeout(context.Background(), contextTimeout)
 	defer cancel()
@@ -50,3 +68,61 @@ func BenchmarkSetAll(b *testing.B) {
 		s.SetAll(ctx, metricsToSet)
 	}
 }
+
+// BenchmarkSetParallel updates distinct series from all goroutines.
+// Run with -cpu 1,2,4,8 to see how the throughput scales with cores.
+func BenchmarkSetParallel(b *testing.B) {
+	ctx, cancel := context.WithTimeout(context.Background(), contextTimeout)
+	defer cancel()
+
+	config := config.GetDefault()
+	s, _ := NewStorage(ctx, config)
+
+	metricsToSet := make([]metrics.Metric, 1024)
+	for i := range metricsToSet {
+		metricsToSet[i] = metrics.NewCounterMetric("Requests", counterValue)
+		metricsToSet[i].Labels = map[string]string{"series": strconv.Itoa(i)}
+	}
+
+	// goroutines start at different series, so they do not update the same series in lockstep
+	var offset atomic.Int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for i := int(offset.Add(97)); pb.Next(); i++ {
+			s.Set(ctx, metricsToSet[i%len(metricsToSet)])
+		}
+	})
+}
+
+// BenchmarkGetParallel reads distinct series from all goroutines while one goroutine keeps updating them.
+func BenchmarkGetParallel(b *testing.B) {
+	ctx, cancel := context.WithTimeout(context.Background(), contextTimeout)
+	defer cancel()
+
+	config := config.GetDefault()
+	s, _ := NewStorage(ctx, config)
+
+	for _, v := range metrics.GaugeMetrics {
+		s.Set(ctx, metrics.NewGaugeMetric(v, gaugeValue))
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+				s.Set(ctx, metrics.NewGaugeMetric(metrics.GaugeMetrics[i%len(metrics.GaugeMetrics)], gaugeValue))
+			}
+		}
+	}()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			s.Get(ctx, metrics.GaugeMetrics[i%len(metrics.GaugeMetrics)], nil)
+		}
+	})
+}
@@ -0,0 +1,175 @@
+package memory
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+)
+
+// snapshotVersion is the version of the snapshot format written by writeSnapshot.
+//
+// A snapshot is a JSON header line followed by the JSON encoded metrics:
+//
+//	{"version":1,"size":1234,"checksum":567890}
+//	{"Alloc":{"id":"Alloc","type":"gauge","value":1},...}
+//
+// Size and checksum (CRC-32C) cover the metrics part. Files written before the header
+// was introduced consist of the metrics part only and are still read.
+const snapshotVersion = 1
+
+var (
+	errCorruptSnapshot = errors.New("corrupt snapshot")
+	crcTable           = crc32.MakeTable(crc32.Castagnoli)
+)
+
+type snapshotHeader struct {
+	Version  int    `json:"version"`
+	Size     int    `json:"size"`
+	Checksum uint32 `json:"checksum"`
+}
+
+// snapshotPath returns the path of the snapshot generation, 0 being the newest one.
+func snapshotPath(path string, generation int) string {
+	if generation == 0 {
+		return path
+	}
+	return path + "." + strconv.Itoa(generation)
+}
+
+// writeSnapshot atomically replaces the snapshot at the path, keeping up to keep previous snapshots
+// as path.1 (the newest) to path.<keep> (the oldest).
+//
+// The snapshot is written to a temporary file and synced to disk before it is renamed,
+// so a crash leaves either the previous or the new snapshot in place.
+func writeSnapshot(path string, keep int, data map[string]metrics.Metric) error {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("memory.writeSnapshot: %w", err)
+	}
+	header, err := json.Marshal(snapshotHeader{
+		Version:  snapshotVersion,
+		Size:     len(body),
+		Checksum: crc32.Checksum(body, crcTable),
+	})
+	if err != nil {
+		return fmt.Errorf("memory.writeSnapshot: %w", err)
+	}
+
+	tmpPath := path + ".tmp"
+	if err := writeFileSync(tmpPath, header, []byte("\n"), body); err != nil {
+		return fmt.Errorf("memory.writeSnapshot: %w", err)
+	}
+
+	// shift previous snapshots, dropping the oldest one
+	for gen := keep; gen > 0; gen-- {
+		err := os.Rename(snapshotPath(path, gen-1), snapshotPath(path, gen))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("memory.writeSnapshot: %w", err)
+		}
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("memory.writeSnapshot: %w", err)
+	}
+	if err := syncDir(filepath.Dir(path)); err != nil {
+		return fmt.Errorf("memory.writeSnapshot: %w", err)
+	}
+	return nil
+}
+
+// restoreSnapshot reads the newest valid snapshot of the path and its keep previous generations.
+// Corrupt snapshots are skipped with a warning. It returns nil metrics if there are no snapshots at all.
+func restoreSnapshot(path string, keep int) (map[string]metrics.Metric, error) {
+	var errs []error
+	for gen := 0; gen <= keep; gen++ {
+		genPath := snapshotPath(path, gen)
+		data, err := readSnapshot(genPath)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			log.Warn().Str("path", genPath).Msgf("skipping unreadable snapshot, %s", err.Error())
+			errs = append(errs, err)
+			continue
+		}
+		if gen > 0 {
+			log.Warn().Str("path", genPath).Msg("restored metrics from a previous snapshot")
+		}
+		return data, nil
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("memory.restoreSnapshot: no valid snapshot, %w", errors.Join(errs...))
+	}
+	return nil, nil
+}
+
+// readSnapshot reads and verifies the snapshot at the path.
+func readSnapshot(path string) (map[string]metrics.Metric, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("memory.readSnapshot: %w", err)
+	}
+
+	body := content
+	headerLine, rest, found := bytes.Cut(content, []byte("\n"))
+	var header snapshotHeader
+	if found && json.Unmarshal(headerLine, &header) == nil && header.Version > 0 {
+		if header.Version > snapshotVersion {
+			return nil, fmt.Errorf("memory.readSnapshot: unsupported snapshot version %d", header.Version)
+		}
+		if len(rest) != header.Size || crc32.Checksum(rest, crcTable) != header.Checksum {
+			return nil, fmt.Errorf("memory.readSnapshot: '%s', %w", path, errCorruptSnapshot)
+		}
+		body = rest
+	}
+
+	data := make(map[string]metrics.Metric)
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, fmt.Errorf("memory.readSnapshot: '%s', %w, %w", path, errCorruptSnapshot, err)
+	}
+	return data, nil
+}
+
+// writeFileSync writes the parts to the file and syncs it to disk.
+func writeFileSync(path string, parts ...[]byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	for _, p := range parts {
+		if _, err := writer.Write(p); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// syncDir syncs the directory, persisting renames of its files.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
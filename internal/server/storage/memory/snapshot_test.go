@@ -0,0 +1,141 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+	"github.com/ulixes-bloom/ya-metrics/internal/server/config"
+)
+
+func TestSnapshot(t *testing.T) {
+	first := map[string]metrics.Metric{
+		"Alloc":     metrics.NewGaugeMetric("Alloc", 1),
+		"PollCount": metrics.NewCounterMetric("PollCount", 10),
+	}
+	second := map[string]metrics.Metric{
+		"Alloc": metrics.NewGaugeMetric("Alloc", 2),
+	}
+
+	tests := []struct {
+		name    string
+		corrupt func(t *testing.T, path string)
+		want    map[string]metrics.Metric
+		wantErr bool
+	}{
+		{
+			name: "Newest snapshot is restored",
+			want: second,
+		},
+		{
+			name: "Previous snapshot is restored if the newest one is corrupt",
+			corrupt: func(t *testing.T, path string) {
+				content, err := os.ReadFile(path)
+				require.NoError(t, err)
+				content[len(content)-3] ^= 0xff
+				require.NoError(t, os.WriteFile(path, content, 0644))
+			},
+			want: first,
+		},
+		{
+			name: "Previous snapshot is restored if the newest one is missing",
+			corrupt: func(t *testing.T, path string) {
+				require.NoError(t, os.Remove(path))
+			},
+			want: first,
+		},
+		{
+			name: "Snapshot without header is restored",
+			corrupt: func(t *testing.T, path string) {
+				content, err := json.Marshal(first)
+				require.NoError(t, err)
+				require.NoError(t, os.WriteFile(path, content, 0644))
+			},
+			want: first,
+		},
+		{
+			name: "Restoring fails if all snapshots are corrupt",
+			corrupt: func(t *testing.T, path string) {
+				for gen := range 2 {
+					require.NoError(t, os.WriteFile(snapshotPath(path, gen), []byte("{\"version\":1,\"size\":2,\"checksum\":1}\n{}"), 0644))
+				}
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "metrics.json")
+			require.NoError(t, writeSnapshot(path, 1, first))
+			require.NoError(t, writeSnapshot(path, 1, second))
+			if test.corrupt != nil {
+				test.corrupt(t, path)
+			}
+
+			restored, err := restoreSnapshot(path, 1)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.want, restored)
+		})
+	}
+}
+
+func TestSnapshotRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	for i := range 4 {
+		require.NoError(t, writeSnapshot(path, 2, map[string]metrics.Metric{
+			"Alloc": metrics.NewGaugeMetric("Alloc", float64(i)),
+		}))
+	}
+
+	for gen, want := range []float64{3, 2, 1} {
+		data, err := readSnapshot(snapshotPath(path, gen))
+		require.NoError(t, err)
+		alloc := data["Alloc"]
+		assert.Equal(t, want, alloc.GetValue())
+	}
+	assert.NoFileExists(t, snapshotPath(path, 3))
+	assert.NoFileExists(t, path+".tmp")
+
+	restored, err := restoreSnapshot(filepath.Join(t.TempDir(), "missing.json"), 2)
+	require.NoError(t, err)
+	assert.Nil(t, restored)
+}
+
+func TestSnapshotConcurrentWrites(t *testing.T) {
+	ctx := context.Background()
+	conf := config.GetDefault()
+	conf.StoreInterval = 300
+	conf.FileStoragePath = filepath.Join(t.TempDir(), "metrics.json")
+	ms, err := NewStorage(ctx, conf)
+	require.NoError(t, err)
+
+	// writers share the temporary file and the generations, so they must not interleave
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 10 {
+				assert.NoError(t, ms.saveMetricsToFile())
+			}
+		}()
+	}
+	wg.Wait()
+
+	for gen := range conf.SnapshotKeep + 1 {
+		_, err := readSnapshot(snapshotPath(conf.FileStoragePath, gen))
+		assert.NoError(t, err, "generation %d", gen)
+	}
+	assert.NoFileExists(t, conf.FileStoragePath+".tmp")
+}
@@ -0,0 +1,215 @@
+package memory
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+)
+
+// maxRecordSize limits the size of a single WAL record.
+const maxRecordSize = 1 << 20
+
+// wal is an append-only write-ahead log of metric updates.
+//
+// The log is a sequence of numbered segment files path.<seq>. Updates are appended to the newest segment,
+// and older segments are removed once a snapshot includes their updates.
+// Every record is a line with the CRC-32C checksum of the JSON encoded metric followed by the metric:
+//
+//	1f2e3d4c {"id":"PollCount","type":"counter","delta":15}
+//
+// Records hold the stored state of the series after the update rather than the update itself,
+// so replaying a record that is already part of the snapshot is harmless.
+type wal struct {
+	path  string
+	seq   uint64 // number of the segment being appended to
+	file  *os.File
+	mutex sync.Mutex
+}
+
+// openWAL creates an empty segment seq of the log at the path, replacing the existing one.
+func openWAL(path string, seq uint64) (*wal, error) {
+	file, err := createSegment(path, seq)
+	if err != nil {
+		return nil, fmt.Errorf("memory.openWAL: %w", err)
+	}
+	return &wal{path: path, seq: seq, file: file}, nil
+}
+
+// append writes records of the metrics and syncs them to disk.
+func (w *wal) append(metricsSlice ...metrics.Metric) error {
+	var buf bytes.Buffer
+	for _, m := range metricsSlice {
+		data, err := json.Marshal(m)
+		if err != nil {
+			return fmt.Errorf("memory.wal.append: %w", err)
+		}
+		buf.WriteString(strconv.FormatUint(uint64(crc32.Checksum(data, crcTable)), 16))
+		buf.WriteByte(' ')
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if _, err := w.file.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("memory.wal.append: %w", err)
+	}
+	if err := w.file.Sync(); err != nil {
+		return fmt.Errorf("memory.wal.append: %w", err)
+	}
+	return nil
+}
+
+// rotate switches appending to a new segment and returns its number.
+// Segments before it can be removed once their updates are part of a snapshot.
+func (w *wal) rotate() (uint64, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	file, err := createSegment(w.path, w.seq+1)
+	if err != nil {
+		return 0, fmt.Errorf("memory.wal.rotate: %w", err)
+	}
+	if err := w.file.Close(); err != nil {
+		file.Close()
+		return 0, fmt.Errorf("memory.wal.rotate: %w", err)
+	}
+	w.seq++
+	w.file = file
+	return w.seq, nil
+}
+
+// close closes the current segment and returns the number following it,
+// so all segments are before it.
+func (w *wal) close() (uint64, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if err := w.file.Close(); err != nil {
+		return 0, fmt.Errorf("memory.wal.close: %w", err)
+	}
+	return w.seq + 1, nil
+}
+
+func segmentPath(path string, seq uint64) string {
+	return path + "." + strconv.FormatUint(seq, 10)
+}
+
+func createSegment(path string, seq uint64) (*os.File, error) {
+	file, err := os.OpenFile(segmentPath(path, seq), os.O_WRONLY|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syncDir(filepath.Dir(path)); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// walSegments returns the numbers of the existing segments of the log at the path in ascending order.
+func walSegments(path string) ([]uint64, error) {
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return nil, fmt.Errorf("memory.walSegments: %w", err)
+	}
+
+	var res []uint64
+	for _, m := range matches {
+		seq, err := strconv.ParseUint(strings.TrimPrefix(m, path+"."), 10, 64)
+		if err != nil {
+			continue
+		}
+		res = append(res, seq)
+	}
+	slices.Sort(res)
+	return res, nil
+}
+
+// removeWALSegments removes the segments of the log at the path numbered before the seq.
+func removeWALSegments(path string, seq uint64) error {
+	segments, err := walSegments(path)
+	if err != nil {
+		return fmt.Errorf("memory.removeWALSegments: %w", err)
+	}
+	for _, s := range segments {
+		if s >= seq {
+			break
+		}
+		if err := os.Remove(segmentPath(path, s)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("memory.removeWALSegments: %w", err)
+		}
+	}
+	return nil
+}
+
+// replayWAL applies records of the segments of the log at the path in order. A missing log has no records.
+// Replaying a segment stops at its first invalid record, which is the tail torn by a crash in the middle of an append.
+func replayWAL(path string, apply func(metrics.Metric)) error {
+	segments, err := walSegments(path)
+	if err != nil {
+		return fmt.Errorf("memory.replayWAL: %w", err)
+	}
+	for _, seq := range segments {
+		if err := replaySegment(segmentPath(path, seq), apply); err != nil {
+			return fmt.Errorf("memory.replayWAL: %w", err)
+		}
+	}
+	return nil
+}
+
+func replaySegment(path string, apply func(metrics.Metric)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("memory.replaySegment: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxRecordSize)
+	for n := 1; scanner.Scan(); n++ {
+		m, err := parseRecord(scanner.Bytes())
+		if err != nil {
+			log.Warn().Str("path", path).Msgf("skipping WAL records starting with record %d, %s", n, err.Error())
+			return nil
+		}
+		apply(m)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("memory.replaySegment: %w", err)
+	}
+	return nil
+}
+
+func parseRecord(line []byte) (metrics.Metric, error) {
+	var m metrics.Metric
+
+	checksum, data, found := bytes.Cut(line, []byte(" "))
+	if !found {
+		return m, errors.New("memory.parseRecord: missing checksum")
+	}
+	want, err := strconv.ParseUint(string(checksum), 16, 32)
+	if err != nil || uint32(want) != crc32.Checksum(data, crcTable) {
+		return m, errors.New("memory.parseRecord: checksum mismatch")
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("memory.parseRecord: %w", err)
+	}
+	return m, nil
+}
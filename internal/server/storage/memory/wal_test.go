@@ -0,0 +1,155 @@
+package memory
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+	"github.com/ulixes-bloom/ya-metrics/internal/server/config"
+)
+
+func TestWAL(t *testing.T) {
+	tests := []struct {
+		name    string
+		compact bool
+		tear    bool
+	}{
+		{name: "Updates are replayed from the log"},
+		{name: "Updates are restored from the compacted snapshot", compact: true},
+		{name: "Torn tail of the log is skipped", tear: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			conf := config.GetDefault()
+			conf.StoreInterval = 0
+			conf.FileStoragePath = filepath.Join(t.TempDir(), "metrics.json")
+
+			ms, err := NewStorage(ctx, conf)
+			require.NoError(t, err)
+			_, err = ms.Set(ctx, metrics.NewCounterMetric("PollCount", 2))
+			require.NoError(t, err)
+			_, err = ms.SetAll(ctx, []metrics.Metric{
+				metrics.NewCounterMetric("PollCount", 3),
+				metrics.NewGaugeMetric("Alloc", 1.5),
+			})
+			require.NoError(t, err)
+
+			if test.compact {
+				require.NoError(t, ms.compactWAL(false))
+				segments, err := walSegments(ms.walPath())
+				require.NoError(t, err)
+				assert.Equal(t, []uint64{1}, segments)
+				info, err := os.Stat(segmentPath(ms.walPath(), 1))
+				require.NoError(t, err)
+				assert.Zero(t, info.Size())
+			}
+			if test.tear {
+				f, err := os.OpenFile(segmentPath(ms.walPath(), ms.wal.seq), os.O_WRONLY|os.O_APPEND, 0644)
+				require.NoError(t, err)
+				_, err = f.WriteString(`1234 {"id":"Alloc","type":"gau`)
+				require.NoError(t, err)
+				require.NoError(t, f.Close())
+			}
+
+			// the storage is not shut down, as after a crash
+			restored, err := NewStorage(ctx, conf)
+			require.NoError(t, err)
+
+			counter, err := restored.Get(ctx, "PollCount", nil)
+			require.NoError(t, err)
+			assert.Equal(t, int64(5), counter.GetDelta())
+			gauge, err := restored.Get(ctx, "Alloc", nil)
+			require.NoError(t, err)
+			assert.Equal(t, 1.5, gauge.GetValue())
+
+			// the restored updates are part of the new snapshot, the log starts with an empty segment
+			segments, err := walSegments(restored.walPath())
+			require.NoError(t, err)
+			assert.Equal(t, []uint64{restored.wal.seq}, segments)
+			info, err := os.Stat(segmentPath(restored.walPath(), restored.wal.seq))
+			require.NoError(t, err)
+			assert.Zero(t, info.Size())
+		})
+	}
+}
+
+func TestWALCompactConcurrent(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	conf := config.GetDefault()
+	conf.StoreInterval = 0
+	conf.FileStoragePath = filepath.Join(t.TempDir(), "metrics.json")
+
+	ms, err := NewStorage(ctx, conf)
+	require.NoError(t, err)
+
+	const writers, updates = 4, 50
+	var wg sync.WaitGroup
+	for w := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range updates {
+				_, err := ms.Set(ctx, metrics.NewCounterMetric("PollCount", 1))
+				assert.NoError(t, err)
+				_, err = ms.SetAll(ctx, []metrics.Metric{
+					metrics.NewCounterMetric("Requests", 1),
+					metrics.NewGaugeMetric("Writer", float64(w)),
+				})
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	for range 5 {
+		require.NoError(t, ms.compactWAL(false))
+	}
+	wg.Wait()
+
+	// updates logged while compacting are in either the snapshot or the remaining segments
+	restored, err := NewStorage(ctx, conf)
+	require.NoError(t, err)
+	for _, id := range []string{"PollCount", "Requests"} {
+		counter, err := restored.Get(ctx, id, nil)
+		require.NoError(t, err)
+		assert.Equal(t, int64(writers*updates), counter.GetDelta())
+	}
+}
+
+func TestWALShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	conf := config.GetDefault()
+	conf.StoreInterval = 0
+	conf.Restore = true
+	conf.FileStoragePath = filepath.Join(t.TempDir(), "metrics.json")
+
+	ms, err := NewStorage(ctx, conf)
+	require.NoError(t, err)
+	_, err = ms.Set(ctx, metrics.NewCounterMetric("PollCount", 2))
+	require.NoError(t, err)
+
+	// both the HTTP and the gRPC server shut the storage down
+	require.NoError(t, ms.Shutdown(ctx))
+	require.NoError(t, ms.Shutdown(ctx))
+
+	segments, err := walSegments(ms.walPath())
+	require.NoError(t, err)
+	assert.Empty(t, segments)
+
+	restored, err := NewStorage(ctx, conf)
+	require.NoError(t, err)
+	counter, err := restored.Get(ctx, "PollCount", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), counter.GetDelta())
+}
@@ -0,0 +1,264 @@
+package pg
+
+import (
+	"cmp"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+// migrationFiles holds the schema migrations as pairs of <version>_<name>.up.sql and <version>_<name>.down.sql files.
+// Versions are applied in ascending order, every migration in its own transaction.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockKey identifies the advisory lock held while migrations are applied,
+// so server replicas starting at the same time do not apply them concurrently.
+const migrationLockKey = 7270486915
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration describes a schema migration and whether it is applied to the database.
+type Migration struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+type migration struct {
+	version int64
+	name    string
+	up      string
+	down    string
+}
+
+// MigrateUp applies all pending migrations.
+func MigrateUp(ctx context.Context, pool *pgxpool.Pool) error {
+	return withMigrationLock(ctx, pool, func(conn *pgxpool.Conn) error {
+		migrations, applied, err := loadMigrationState(ctx, conn)
+		if err != nil {
+			return fmt.Errorf("pg.migrateUp: %w", err)
+		}
+		for version := range applied {
+			if !slices.ContainsFunc(migrations, func(m migration) bool { return m.version == version }) {
+				log.Warn().Int64("version", version).Msg("database schema has a migration unknown to this server")
+			}
+		}
+
+		for _, m := range migrations {
+			if _, ok := applied[m.version]; ok {
+				continue
+			}
+			if err := applyMigration(ctx, conn, m, true); err != nil {
+				return fmt.Errorf("pg.migrateUp: %w", err)
+			}
+			log.Info().Int64("version", m.version).Str("name", m.name).Msg("applied migration")
+		}
+		return nil
+	})
+}
+
+// MigrateDown reverts the latest applied migration.
+func MigrateDown(ctx context.Context, pool *pgxpool.Pool) error {
+	return withMigrationLock(ctx, pool, func(conn *pgxpool.Conn) error {
+		migrations, applied, err := loadMigrationState(ctx, conn)
+		if err != nil {
+			return fmt.Errorf("pg.migrateDown: %w", err)
+		}
+		if len(applied) == 0 {
+			return errors.New("pg.migrateDown: no applied migrations")
+		}
+
+		var latest int64
+		for version := range applied {
+			latest = max(latest, version)
+		}
+		i := slices.IndexFunc(migrations, func(m migration) bool { return m.version == latest })
+		if i < 0 {
+			return fmt.Errorf("pg.migrateDown: migration %d is unknown to this server", latest)
+		}
+
+		if err := applyMigration(ctx, conn, migrations[i], false); err != nil {
+			return fmt.Errorf("pg.migrateDown: %w", err)
+		}
+		log.Info().Int64("version", latest).Str("name", migrations[i].name).Msg("reverted migration")
+		return nil
+	})
+}
+
+// MigrationStatus returns all known migrations in the order they are applied.
+func MigrationStatus(ctx context.Context, pool *pgxpool.Pool) ([]Migration, error) {
+	var res []Migration
+	err := withMigrationLock(ctx, pool, func(conn *pgxpool.Conn) error {
+		migrations, applied, err := loadMigrationState(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			appliedAt, ok := applied[m.version]
+			res = append(res, Migration{Version: m.version, Name: m.name, Applied: ok, AppliedAt: appliedAt})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("pg.migrationStatus: %w", err)
+	}
+	return res, nil
+}
+
+// withMigrationLock runs fn on a dedicated connection holding the migration advisory lock.
+// Advisory locks belong to the session, so the lock is taken and released on the same connection.
+func withMigrationLock(ctx context.Context, pool *pgxpool.Pool, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("pg.withMigrationLock.acquire: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, migrationLockKey); err != nil {
+		return fmt.Errorf("pg.withMigrationLock.lock: %w", err)
+	}
+	defer func() {
+		if _, err := conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockKey); err != nil {
+			log.Error().Msg(fmt.Errorf("pg.withMigrationLock.unlock: %w", err).Error())
+			// close the connection, so the lock is released with its session
+			conn.Hijack().Close(context.Background())
+		}
+	}()
+
+	_, err = conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations
+		(
+			version    bigint PRIMARY KEY,
+			name       varchar(255) NOT NULL,
+			applied_at timestamptz NOT NULL DEFAULT now()
+		);`)
+	if err != nil {
+		return fmt.Errorf("pg.withMigrationLock.createTable: %w", err)
+	}
+	return fn(conn)
+}
+
+// loadMigrationState returns the embedded migrations and the application times of the applied ones by version.
+func loadMigrationState(ctx context.Context, conn *pgxpool.Conn) ([]migration, map[int64]time.Time, error) {
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		return nil, nil, fmt.Errorf("pg.loadMigrationState: %w", err)
+	}
+
+	rows, err := conn.Query(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, nil, fmt.Errorf("pg.loadMigrationState.query: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, nil, fmt.Errorf("pg.loadMigrationState.rowsScan: %w", err)
+		}
+		applied[version] = appliedAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("pg.loadMigrationState.rowsErr: %w", err)
+	}
+	return migrations, applied, nil
+}
+
+// applyMigration runs the up or down script of the migration and records it in schema_migrations
+// within a single transaction.
+func applyMigration(ctx context.Context, conn *pgxpool.Conn, m migration, up bool) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("pg.applyMigration.begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	script := m.down
+	if up {
+		script = m.up
+	}
+	if _, err := tx.Exec(ctx, script); err != nil {
+		return fmt.Errorf("pg.applyMigration: migration %d_%s, %w", m.version, m.name, err)
+	}
+
+	if up {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO schema_migrations (version, name)
+			VALUES ($1, $2)`, m.version, m.name)
+	} else {
+		_, err = tx.Exec(ctx, `
+			DELETE FROM schema_migrations
+			WHERE version=$1`, m.version)
+	}
+	if err != nil {
+		return fmt.Errorf("pg.applyMigration.record: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("pg.applyMigration.commit: %w", err)
+	}
+	return nil
+}
+
+// loadMigrations reads the migration files of the migrations directory sorted by version.
+// Every version must have both the up and the down script.
+func loadMigrations(fsys fs.FS) ([]migration, error) {
+	entries, err := fs.ReadDir(fsys, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("pg.loadMigrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*migration)
+	for _, e := range entries {
+		match := migrationFileName.FindStringSubmatch(e.Name())
+		if match == nil {
+			return nil, fmt.Errorf("pg.loadMigrations: invalid migration file name '%s'", e.Name())
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("pg.loadMigrations: %w", err)
+		}
+		script, err := fs.ReadFile(fsys, "migrations/"+e.Name())
+		if err != nil {
+			return nil, fmt.Errorf("pg.loadMigrations: %w", err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{version: version, name: match[2]}
+			byVersion[version] = m
+		}
+		if m.name != match[2] {
+			return nil, fmt.Errorf("pg.loadMigrations: migration %d has different names '%s' and '%s'", version, m.name, match[2])
+		}
+		if match[3] == "up" {
+			m.up = string(script)
+		} else {
+			m.down = string(script)
+		}
+	}
+
+	res := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("pg.loadMigrations: migration %d_%s misses the up or down script", m.version, m.name)
+		}
+		res = append(res, *m)
+	}
+	slices.SortFunc(res, func(a, b migration) int { return cmp.Compare(a.version, b.version) })
+	return res, nil
+}
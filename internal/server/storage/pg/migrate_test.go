@@ -0,0 +1,77 @@
+package pg
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    fstest.MapFS
+		versions []int64
+		wantErr  bool
+	}{
+		{
+			name: "Migrations are sorted by version",
+			files: fstest.MapFS{
+				"migrations/0010_add_index.up.sql":      {Data: []byte("CREATE INDEX")},
+				"migrations/0010_add_index.down.sql":    {Data: []byte("DROP INDEX")},
+				"migrations/0002_create_table.up.sql":   {Data: []byte("CREATE TABLE")},
+				"migrations/0002_create_table.down.sql": {Data: []byte("DROP TABLE")},
+			},
+			versions: []int64{2, 10},
+		},
+		{
+			name: "Missing down script",
+			files: fstest.MapFS{
+				"migrations/0001_create_table.up.sql": {Data: []byte("CREATE TABLE")},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Invalid file name",
+			files: fstest.MapFS{
+				"migrations/create_table.sql": {Data: []byte("CREATE TABLE")},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Scripts of a version with different names",
+			files: fstest.MapFS{
+				"migrations/0001_create_table.up.sql": {Data: []byte("CREATE TABLE")},
+				"migrations/0001_drop_table.down.sql": {Data: []byte("DROP TABLE")},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			migrations, err := loadMigrations(test.files)
+			if test.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			versions := make([]int64, 0, len(migrations))
+			for _, m := range migrations {
+				versions = append(versions, m.version)
+				assert.NotEmpty(t, m.up)
+				assert.NotEmpty(t, m.down)
+			}
+			assert.Equal(t, test.versions, versions)
+		})
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := loadMigrations(migrationFiles)
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+	assert.Equal(t, int64(1), migrations[0].version)
+}
@@ -0,0 +1,8 @@
+-- The table may already exist in databases created before migrations were introduced.
+CREATE TABLE IF NOT EXISTS metrics
+(
+	id    varchar(255) PRIMARY KEY,
+	type  varchar(30) NOT NULL,
+	delta bigint,
+	value double precision
+);
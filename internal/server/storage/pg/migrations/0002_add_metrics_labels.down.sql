@@ -0,0 +1,13 @@
+-- Series with labels and of types other than counters and gauges cannot be kept
+-- in the table identified by the id only.
+DELETE FROM metrics
+WHERE labels <> '{}' OR type NOT IN ('counter', 'gauge');
+
+ALTER TABLE metrics
+	DROP CONSTRAINT IF EXISTS metrics_pkey,
+	DROP COLUMN IF EXISTS labels,
+	DROP COLUMN IF EXISTS count,
+	DROP COLUMN IF EXISTS sum,
+	DROP COLUMN IF EXISTS buckets,
+	DROP COLUMN IF EXISTS quantiles,
+	ADD PRIMARY KEY (id);
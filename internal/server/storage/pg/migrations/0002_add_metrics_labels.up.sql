@@ -0,0 +1,12 @@
+-- Upgrades the metrics table of databases created before series had labels,
+-- where a series is identified by its id only.
+ALTER TABLE metrics
+	ADD COLUMN IF NOT EXISTS labels    jsonb NOT NULL DEFAULT '{}',
+	ADD COLUMN IF NOT EXISTS count     bigint,
+	ADD COLUMN IF NOT EXISTS sum       double precision,
+	ADD COLUMN IF NOT EXISTS buckets   jsonb,
+	ADD COLUMN IF NOT EXISTS quantiles jsonb;
+
+ALTER TABLE metrics
+	DROP CONSTRAINT IF EXISTS metrics_pkey,
+	ADD PRIMARY KEY (id, labels);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS metrics_history_rollup;
+DROP TABLE IF EXISTS metrics_history;
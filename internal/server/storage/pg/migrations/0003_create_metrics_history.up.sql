@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS metrics_history
+(
+	id     varchar(255) NOT NULL,
+	labels jsonb NOT NULL DEFAULT '{}',
+	ts     timestamptz NOT NULL,
+	value  double precision NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS metrics_history_series_ts_idx
+ON metrics_history (id, labels, ts);
+
+CREATE TABLE IF NOT EXISTS metrics_history_rollup
+(
+	id         varchar(255) NOT NULL,
+	labels     jsonb NOT NULL DEFAULT '{}',
+	resolution bigint NOT NULL,
+	ts         timestamptz NOT NULL,
+	value      double precision NOT NULL,
+	PRIMARY KEY (id, labels, resolution, ts)
+);
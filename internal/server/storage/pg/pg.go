@@ -2,129 +2,353 @@ package pg
 
 import (
 	"context"
-	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
 
-	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
-	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
 	appErrors "github.com/ulixes-bloom/ya-metrics/internal/pkg/errors"
 	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+	"github.com/ulixes-bloom/ya-metrics/internal/server/config"
 )
 
 type pgstorage struct {
-	db *sql.DB
+	pool   *pgxpool.Pool
+	policy config.RetentionPolicy
+	conf   *config.Config
 }
 
-func NewStorage(ctx context.Context, db *sql.DB) (*pgstorage, error) {
-	newStorage := pgstorage{db: db}
+// execer is implemented by both *pgxpool.Pool and pgx.Tx.
+type execer interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
 
-	if err := newStorage.createTables(ctx); err != nil {
-		return nil, fmt.Errorf("pg.NewStorage: %w", err)
-	}
+// metricColumns lists the columns of the metrics table in the order expected by scanMetric.
+const metricColumns = "id, labels, type, delta, value, count, sum, buckets, quantiles"
 
-	if err := newStorage.PingDB(); err != nil {
-		return nil, fmt.Errorf("pg.NewStorage: %w", err)
+// NewPool creates the connection pool of the database conf.DatabaseDSN.
+// Statements are prepared and cached per connection, unless conf.DBStmtCache is 0,
+// e.g. for a database behind a connection pooler in the transaction mode.
+func NewPool(ctx context.Context, conf *config.Config) (*pgxpool.Pool, error) {
+	poolConf, err := pgxpool.ParseConfig(conf.DatabaseDSN)
+	if err != nil {
+		return nil, fmt.Errorf("pg.NewPool: %w", err)
+	}
+	poolConf.MaxConns = int32(conf.DBMaxConns)
+	poolConf.MinConns = int32(conf.DBMinConns)
+	poolConf.MaxConnLifetime = conf.GetDBConnLifetimeDuration()
+	poolConf.MaxConnIdleTime = conf.GetDBConnIdleTimeDuration()
+	if conf.DBStmtCache > 0 {
+		poolConf.ConnConfig.StatementCacheCapacity = conf.DBStmtCache
+	} else {
+		poolConf.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeExec
 	}
 
-	return &newStorage, nil
+	pool, err := pgxpool.NewWithConfig(ctx, poolConf)
+	if err != nil {
+		return nil, fmt.Errorf("pg.NewPool: %w", err)
+	}
+	return pool, nil
 }
 
-func (ps *pgstorage) createTables(ctx context.Context) error {
-	_, err := ps.db.ExecContext(ctx, `
-		CREATE TABLE IF NOT EXISTS metrics
-		(
-			id    varchar(255) PRIMARY KEY, 
-			type  varchar(30) NOT NULL, 
-			delta bigint, 
-			value double precision
-		);`)
+func NewStorage(ctx context.Context, pool *pgxpool.Pool, conf *config.Config) (*pgstorage, error) {
+	policy, err := conf.GetRetentionPolicy()
 	if err != nil {
-		return fmt.Errorf("pg.createTables.metrics: %w", err)
+		return nil, fmt.Errorf("pg.NewStorage: %w", err)
 	}
-	return nil
+	newStorage := pgstorage{pool: pool, policy: policy, conf: conf}
+
+	if err := MigrateUp(ctx, pool); err != nil {
+		return nil, fmt.Errorf("pg.NewStorage: %w", err)
+	}
+
+	if err := newStorage.Ping(ctx); err != nil {
+		return nil, fmt.Errorf("pg.NewStorage: %w", err)
+	}
+	newStorage.startCompactor(ctx)
+
+	return &newStorage, nil
 }
 
 func (ps *pgstorage) Shutdown(ctx context.Context) error {
-	return ps.db.Close()
+	ps.pool.Close()
+	return nil
 }
 
-func (ps *pgstorage) PingDB() error {
-	if err := ps.db.Ping(); err != nil {
-		return fmt.Errorf("pg.pingDB: %w", err)
+// Ping checks the database is reachable with a connection of the pool.
+func (ps *pgstorage) Ping(ctx context.Context) error {
+	if err := ps.pool.Ping(ctx); err != nil {
+		return fmt.Errorf("pg.ping: %w", err)
 	}
 	return nil
 }
 
 func (ps *pgstorage) Set(ctx context.Context, metric metrics.Metric) (metrics.Metric, error) {
-	if metric.MType != metrics.Counter && metric.MType != metrics.Gauge {
+	switch metric.MType {
+	case metrics.Counter, metrics.Gauge:
+		labels, err := encodeLabels(metric.Labels)
+		if err != nil {
+			return metric, fmt.Errorf("pg.set: %w", err)
+		}
+
+		// a series of another type is left untouched and no row is returned
+		stored := metric
+		row := ps.pool.QueryRow(ctx, `
+			INSERT INTO metrics (id, labels, type, delta, value)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (id, labels)
+			DO UPDATE SET delta=metrics.delta+$4, value=$5
+			WHERE metrics.type=$3
+			RETURNING delta, value`, metric.ID, labels, metric.MType, metric.Delta, metric.Value)
+		err = row.Scan(&stored.Delta, &stored.Value)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return metric, fmt.Errorf("pg.set: series '%s', %w", metric.Key(), appErrors.ErrMetricTypeMismatch)
+		}
+		if err != nil {
+			return metric, fmt.Errorf("pg.set: %w", err)
+		}
+		if err = ps.addSample(ctx, ps.pool, stored); err != nil {
+			return metric, fmt.Errorf("pg.set: %w", err)
+		}
+		return stored, nil
+	case metrics.Histogram, metrics.Summary:
+		tx, err := ps.pool.Begin(ctx)
+		if err != nil {
+			return metric, fmt.Errorf("pg.set.begin: %w", err)
+		}
+		defer tx.Rollback(ctx)
+
+		metric, err = setAggregate(ctx, tx, metric)
+		if err != nil {
+			return metric, fmt.Errorf("pg.set: %w", err)
+		}
+		if err = ps.addSample(ctx, tx, metric); err != nil {
+			return metric, fmt.Errorf("pg.set: %w", err)
+		}
+		if err = tx.Commit(ctx); err != nil {
+			return metric, fmt.Errorf("pg.set.commit: %w", err)
+		}
+		return metric, nil
+	default:
 		return metric, appErrors.ErrMetricTypeNotImplemented
 	}
+}
 
-	_, err := ps.db.ExecContext(ctx, `
-		INSERT INTO metrics (id, type, delta, value)
-		VALUES ($1, $2, $3, $4)
-		ON CONFLICT (id) 
-		DO UPDATE SET id=$1, type=$2, delta=metrics.delta+$3, value=$4`, metric.ID, metric.MType, metric.Delta, metric.Value)
-	if err != nil {
-		return metric, fmt.Errorf("pg.set: %w", err)
+// SetAll stores the metrics in a single transaction. Counters and gauges are upserted
+// with a single multi-row statement, histograms and summaries are merged one by one.
+// It returns the stored state of the updated series, counters and gauges once per series
+// followed by the state after every histogram and summary update.
+func (ps *pgstorage) SetAll(ctx context.Context, metricsSlice []metrics.Metric) ([]metrics.Metric, error) {
+	if len(metricsSlice) == 0 {
+		return nil, nil
 	}
-	return metric, nil
-}
 
-func (ps *pgstorage) SetAll(ctx context.Context, meticsSlice []metrics.Metric) error {
-	if len(meticsSlice) == 0 {
-		return nil
+	var scalars, aggregates []metrics.Metric
+	for _, m := range metricsSlice {
+		switch m.MType {
+		case metrics.Counter, metrics.Gauge:
+			scalars = append(scalars, m)
+		case metrics.Histogram, metrics.Summary:
+			aggregates = append(aggregates, m)
+		default:
+			return nil, appErrors.ErrMetricTypeNotImplemented
+		}
 	}
 
-	tx, err := ps.db.BeginTx(ctx, nil)
+	tx, err := ps.pool.Begin(ctx)
 	if err != nil {
-		return fmt.Errorf("pg.setAll.begin: %w", err)
+		return nil, fmt.Errorf("pg.setAll.begin: %w", err)
 	}
-	defer tx.Rollback()
+	defer tx.Rollback(ctx)
 
-	stmt, err := tx.PrepareContext(ctx, `
-		INSERT INTO metrics (id, type, delta, value)
-		VALUES ($1, $2, $3, $4)
-		ON CONFLICT (id)
-		DO UPDATE SET id=$1, type=$2, delta=metrics.delta+$3, value=$4`)
+	merged, err := mergeScalars(scalars)
+	if err != nil {
+		return nil, fmt.Errorf("pg.setAll: %w", err)
+	}
+	stored, err := upsertScalars(ctx, tx, merged)
 	if err != nil {
-		return fmt.Errorf("pg.setAll.stmtPrepare: %w", err)
+		return nil, fmt.Errorf("pg.setAll: %w", err)
+	}
+	for _, m := range stored {
+		if err = ps.addSample(ctx, tx, m); err != nil {
+			return nil, fmt.Errorf("pg.setAll: %w", err)
+		}
 	}
 
-	for _, m := range meticsSlice {
-		if m.MType != metrics.Counter && m.MType != metrics.Gauge {
-			return appErrors.ErrMetricTypeNotImplemented
+	for _, m := range aggregates {
+		merged, err := setAggregate(ctx, tx, m)
+		if err != nil {
+			return nil, fmt.Errorf("pg.setAll: %w", err)
 		}
-		_, err = stmt.ExecContext(ctx, m.ID, m.MType, m.Delta, m.Value)
+		if err = ps.addSample(ctx, tx, merged); err != nil {
+			return nil, fmt.Errorf("pg.setAll: %w", err)
+		}
+		stored = append(stored, merged)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("pg.setAll.commit: %w", err)
+	}
+
+	return stored, nil
+}
+
+// mergeScalars combines counters and gauges of the same series, as a single statement
+// cannot upsert a row twice. Counter deltas are summed, the last gauge value wins.
+func mergeScalars(metricsSlice []metrics.Metric) ([]metrics.Metric, error) {
+	res := make([]metrics.Metric, 0, len(metricsSlice))
+	index := make(map[string]int, len(metricsSlice))
+	for _, m := range metricsSlice {
+		i, exists := index[m.Key()]
+		if !exists {
+			index[m.Key()] = len(res)
+			res = append(res, m)
+			continue
+		}
+		cur := res[i]
+		if cur.MType != m.MType {
+			return nil, fmt.Errorf("pg.mergeScalars: series '%s', %w", m.Key(), appErrors.ErrMetricTypeMismatch)
+		}
+		if m.MType == metrics.Counter {
+			delta := cur.GetDelta() + m.GetDelta()
+			m.Delta = &delta
+		}
+		res[i] = m
+	}
+	return res, nil
+}
+
+// upsertScalars stores counters and gauges of distinct series with a single statement
+// and returns the stored series. Nothing is returned for series of another type,
+// which makes the whole batch fail.
+func upsertScalars(ctx context.Context, tx pgx.Tx, metricsSlice []metrics.Metric) ([]metrics.Metric, error) {
+	if len(metricsSlice) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]string, len(metricsSlice))
+	labels := make([]string, len(metricsSlice))
+	types := make([]string, len(metricsSlice))
+	deltas := make([]*int64, len(metricsSlice))
+	values := make([]*float64, len(metricsSlice))
+	for i, m := range metricsSlice {
+		encoded, err := encodeLabels(m.Labels)
 		if err != nil {
-			return fmt.Errorf("pg.setAll.stmtExec: %w", err)
+			return nil, fmt.Errorf("pg.upsertScalars: %w", err)
 		}
+		ids[i], labels[i], types[i], deltas[i], values[i] = m.ID, encoded, m.MType, m.Delta, m.Value
 	}
-	err = tx.Commit()
+
+	rows, err := tx.Query(ctx, `
+		INSERT INTO metrics (id, labels, type, delta, value)
+		SELECT * FROM unnest($1::varchar[], $2::jsonb[], $3::varchar[], $4::bigint[], $5::double precision[])
+		ON CONFLICT (id, labels)
+		DO UPDATE SET delta=metrics.delta+EXCLUDED.delta, value=EXCLUDED.value
+		WHERE metrics.type=EXCLUDED.type
+		RETURNING id, labels, type, delta, value`, ids, labels, types, deltas, values)
 	if err != nil {
-		return fmt.Errorf("pg.setAll.commit: %w", err)
+		return nil, fmt.Errorf("pg.upsertScalars.query: %w", err)
 	}
+	defer rows.Close()
 
-	return nil
+	stored := make([]metrics.Metric, 0, len(metricsSlice))
+	for rows.Next() {
+		var m metrics.Metric
+		var encoded []byte
+		if err := rows.Scan(&m.ID, &encoded, &m.MType, &m.Delta, &m.Value); err != nil {
+			return nil, fmt.Errorf("pg.upsertScalars.rowsScan: %w", err)
+		}
+		if err := json.Unmarshal(encoded, &m.Labels); err != nil {
+			return nil, fmt.Errorf("pg.upsertScalars.unmarshalLabels: %w", err)
+		}
+		if len(m.Labels) == 0 {
+			m.Labels = nil
+		}
+		stored = append(stored, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("pg.upsertScalars.rowsErr: %w", err)
+	}
+	if len(stored) < len(metricsSlice) {
+		return nil, fmt.Errorf("pg.upsertScalars: %w", appErrors.ErrMetricTypeMismatch)
+	}
+	return stored, nil
 }
 
-func (ps *pgstorage) Get(ctx context.Context, name string) (val metrics.Metric, ok error) {
-	var metric metrics.Metric
-	row := ps.db.QueryRowContext(ctx, `
-		SELECT id, type, delta, value
+func (ps *pgstorage) Get(ctx context.Context, id string, labels map[string]string) (val metrics.Metric, ok error) {
+	encodedLabels, err := encodeLabels(labels)
+	if err != nil {
+		return metrics.Metric{}, fmt.Errorf("pg.get: %w", err)
+	}
+
+	row := ps.pool.QueryRow(ctx, `
+		SELECT `+metricColumns+`
 		FROM metrics
-		WHERE id=$1`, name)
-	if err := row.Scan(&metric.ID, &metric.MType, &metric.Delta, &metric.Value); err != nil {
+		WHERE id=$1 AND labels=$2`, id, encodedLabels)
+	metric, err := scanMetric(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return metric, appErrors.ErrMetricNotExists
+	}
+	if err != nil {
 		return metric, fmt.Errorf("pg.get: %w", err)
 	}
 	return metric, nil
 }
 
+// GetRange returns the history samples of the series recorded between from and to.
+// Samples are read from the finest retention level that still keeps samples as old as from.
+func (ps *pgstorage) GetRange(ctx context.Context, id string, labels map[string]string, from, to time.Time) ([]metrics.Sample, error) {
+	if !ps.conf.HistoryEnabled {
+		return nil, appErrors.ErrHistoryNotEnabled
+	}
+
+	encodedLabels, err := encodeLabels(labels)
+	if err != nil {
+		return nil, fmt.Errorf("pg.getRange: %w", err)
+	}
+
+	var rows pgx.Rows
+	level := ps.policy[ps.policy.LevelFor(time.Since(from))]
+	if level.Resolution == 0 {
+		rows, err = ps.pool.Query(ctx, `
+			SELECT ts, value
+			FROM metrics_history
+			WHERE id=$1 AND labels=$2 AND ts BETWEEN $3 AND $4
+			ORDER BY ts`, id, encodedLabels, from, to)
+	} else {
+		rows, err = ps.pool.Query(ctx, `
+			SELECT ts, value
+			FROM metrics_history_rollup
+			WHERE id=$1 AND labels=$2 AND resolution=$3 AND ts BETWEEN $4 AND $5
+			ORDER BY ts`, id, encodedLabels, int64(level.Resolution.Seconds()), from, to)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("pg.getRange.query: %w", err)
+	}
+	defer rows.Close()
+
+	samples := []metrics.Sample{}
+	for rows.Next() {
+		var sample metrics.Sample
+		if err := rows.Scan(&sample.Timestamp, &sample.Value); err != nil {
+			return nil, fmt.Errorf("pg.getRange.rowsScan: %w", err)
+		}
+		samples = append(samples, sample)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("pg.getRange.rowsErr: %w", err)
+	}
+	return samples, nil
+}
+
 func (ps *pgstorage) GetAll(ctx context.Context) ([]metrics.Metric, error) {
-	rows, err := ps.db.QueryContext(ctx, `
-		SELECT id, type, delta, value
+	rows, err := ps.pool.Query(ctx, `
+		SELECT `+metricColumns+`
 		FROM metrics`)
 	if err != nil {
 		return nil, fmt.Errorf("pg.getAll.query: %w", err)
@@ -133,9 +357,9 @@ func (ps *pgstorage) GetAll(ctx context.Context) ([]metrics.Metric, error) {
 
 	allMetrics := []metrics.Metric{}
 	for rows.Next() {
-		var metric metrics.Metric
-		if err := rows.Scan(&metric.ID, &metric.MType, &metric.Delta, &metric.Value); err != nil {
-			return nil, fmt.Errorf("pg.getAll.rowsScan: %w", err)
+		metric, err := scanMetric(rows)
+		if err != nil {
+			return nil, fmt.Errorf("pg.getAll: %w", err)
 		}
 		allMetrics = append(allMetrics, metric)
 	}
@@ -145,22 +369,216 @@ func (ps *pgstorage) GetAll(ctx context.Context) ([]metrics.Metric, error) {
 	return allMetrics, nil
 }
 
-func PingDB(dsn string) error {
-	db, err := sql.Open("pgx", dsn)
+// startCompactor starts a background process to downsample and expire history samples
+// with period conf.CompactInterval.
+func (ps *pgstorage) startCompactor(ctx context.Context) {
+	if !ps.conf.HistoryEnabled {
+		return
+	}
+	compactTicker := time.NewTicker(ps.conf.GetCompactIntervalDuration())
+
+	go func() {
+		defer compactTicker.Stop()
+		for {
+			select {
+			case now := <-compactTicker.C:
+				if err := ps.compact(ctx, now); err != nil {
+					log.Error().Msg(err.Error())
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// compact applies the retention policy to the history tables.
+// Every rollup level recomputes the averages of the buckets completed since the previous run
+// from the preceding finer level, then samples older than their level period are deleted.
+func (ps *pgstorage) compact(ctx context.Context, now time.Time) error {
+	interval := ps.conf.GetCompactIntervalDuration()
+
+	for i := 1; i < len(ps.policy); i++ {
+		resolution := ps.policy[i].Resolution
+		windowStart := now.Add(-interval - resolution).Truncate(resolution)
+		windowEnd := now.Truncate(resolution)
+
+		source := "metrics_history"
+		args := []any{int64(resolution.Seconds()), windowStart, windowEnd}
+		if prev := ps.policy[i-1].Resolution; prev != 0 {
+			source = "metrics_history_rollup"
+			args = append(args, int64(prev.Seconds()))
+		}
+		filter := "ts >= $2 AND ts < $3"
+		if len(args) == 4 {
+			filter += " AND resolution = $4"
+		}
+
+		_, err := ps.pool.Exec(ctx, `
+			INSERT INTO metrics_history_rollup (id, labels, resolution, ts, value)
+			SELECT id, labels, $1::bigint, bucket, avg(value)
+			FROM (
+				SELECT id, labels, value,
+					to_timestamp(floor(extract(epoch FROM ts) / $1::bigint) * $1::bigint) AS bucket
+				FROM `+source+`
+				WHERE `+filter+`
+			) AS samples
+			GROUP BY id, labels, bucket
+			ON CONFLICT (id, labels, resolution, ts)
+			DO UPDATE SET value = EXCLUDED.value`, args...)
+		if err != nil {
+			return fmt.Errorf("pg.compact.rollup: %w", err)
+		}
+	}
+
+	for i, l := range ps.policy {
+		if l.Period == 0 {
+			continue
+		}
+		var err error
+		if i == 0 {
+			_, err = ps.pool.Exec(ctx, `
+				DELETE FROM metrics_history
+				WHERE ts < $1`, now.Add(-l.Period))
+		} else {
+			_, err = ps.pool.Exec(ctx, `
+				DELETE FROM metrics_history_rollup
+				WHERE resolution = $1 AND ts < $2`, int64(l.Resolution.Seconds()), now.Add(-l.Period))
+		}
+		if err != nil {
+			return fmt.Errorf("pg.compact.expire: %w", err)
+		}
+	}
+	return nil
+}
+
+// addSample appends the current value of the series to the metrics_history table
+// if conf.HistoryEnabled is set.
+func (ps *pgstorage) addSample(ctx context.Context, db execer, metric metrics.Metric) error {
+	if !ps.conf.HistoryEnabled {
+		return nil
+	}
+
+	labels, err := encodeLabels(metric.Labels)
 	if err != nil {
-		return fmt.Errorf("pg.pingDB.openSql: %w", err)
+		return fmt.Errorf("pg.addSample: %w", err)
 	}
-	defer db.Close()
 
-	if err = db.Ping(); err != nil {
-		return fmt.Errorf("pg.pingDB.ping: %w", err)
+	_, err = db.Exec(ctx, `
+		INSERT INTO metrics_history (id, labels, ts, value)
+		VALUES ($1, $2, $3, $4)`, metric.ID, labels, time.Now(), metric.SampleValue())
+	if err != nil {
+		return fmt.Errorf("pg.addSample: %w", err)
 	}
 	return nil
 }
 
-func NeedToRetry() func(err error) bool {
-	return func(err error) bool {
-		var pgErr *pgconn.PgError
-		return errors.As(err, &pgErr) && pgErr.Code == pgerrcode.ConnectionException
+// setAggregate merges histogram or summary observations into the stored series within the transaction.
+// The series row is created first if needed and then locked, so concurrent updates are not lost.
+func setAggregate(ctx context.Context, tx pgx.Tx, metric metrics.Metric) (metrics.Metric, error) {
+	labels, err := encodeLabels(metric.Labels)
+	if err != nil {
+		return metric, fmt.Errorf("pg.setAggregate: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO metrics (id, labels, type)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (id, labels) DO NOTHING`, metric.ID, labels, metric.MType)
+	if err != nil {
+		return metric, fmt.Errorf("pg.setAggregate.insert: %w", err)
+	}
+
+	row := tx.QueryRow(ctx, `
+		SELECT `+metricColumns+`
+		FROM metrics
+		WHERE id=$1 AND labels=$2
+		FOR UPDATE`, metric.ID, labels)
+	cur, err := scanMetric(row)
+	if err != nil {
+		return metric, fmt.Errorf("pg.setAggregate: %w", err)
+	}
+	if cur.MType != metric.MType {
+		return metric, fmt.Errorf("pg.setAggregate: series '%s', %w", metric.Key(), appErrors.ErrMetricTypeMismatch)
+	}
+
+	if metric.MType == metrics.Histogram {
+		metric, err = metrics.MergeHistogram(cur, metric)
+	} else {
+		metric, err = metrics.MergeSummary(cur, metric)
+	}
+	if err != nil {
+		return metric, fmt.Errorf("pg.setAggregate: %w", err)
+	}
+
+	buckets, err := encodeJSON(metric.Buckets)
+	if err != nil {
+		return metric, fmt.Errorf("pg.setAggregate: %w", err)
+	}
+	quantiles, err := encodeJSON(metric.Quantiles)
+	if err != nil {
+		return metric, fmt.Errorf("pg.setAggregate: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE metrics
+		SET type=$3, count=$4, sum=$5, buckets=$6, quantiles=$7
+		WHERE id=$1 AND labels=$2`, metric.ID, labels, metric.MType, metric.Count, metric.Sum, buckets, quantiles)
+	if err != nil {
+		return metric, fmt.Errorf("pg.setAggregate.update: %w", err)
+	}
+	return metric, nil
+}
+
+// scanMetric reads a single metrics row selected with metricColumns.
+func scanMetric(row interface{ Scan(dest ...any) error }) (metrics.Metric, error) {
+	var metric metrics.Metric
+	var labels, buckets, quantiles []byte
+	err := row.Scan(&metric.ID, &labels, &metric.MType, &metric.Delta, &metric.Value,
+		&metric.Count, &metric.Sum, &buckets, &quantiles)
+	if err != nil {
+		return metric, fmt.Errorf("pg.scanMetric: %w", err)
+	}
+	if err := json.Unmarshal(labels, &metric.Labels); err != nil {
+		return metric, fmt.Errorf("pg.scanMetric.unmarshalLabels: %w", err)
+	}
+	if len(metric.Labels) == 0 {
+		metric.Labels = nil
+	}
+	if len(buckets) > 0 {
+		if err := json.Unmarshal(buckets, &metric.Buckets); err != nil {
+			return metric, fmt.Errorf("pg.scanMetric.unmarshalBuckets: %w", err)
+		}
+	}
+	if len(quantiles) > 0 {
+		if err := json.Unmarshal(quantiles, &metric.Quantiles); err != nil {
+			return metric, fmt.Errorf("pg.scanMetric.unmarshalQuantiles: %w", err)
+		}
+	}
+	return metric, nil
+}
+
+// encodeJSON converts optional slice values to jsonb, empty slices are stored as NULL.
+func encodeJSON[T any](values []T) (any, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(values)
+	if err != nil {
+		return nil, fmt.Errorf("pg.encodeJSON: %w", err)
+	}
+	return string(encoded), nil
+}
+
+// encodeLabels converts metric labels to the jsonb representation used in the labels column.
+// Metrics without labels are stored with an empty object, so they share a single series.
+func encodeLabels(labels map[string]string) (string, error) {
+	if len(labels) == 0 {
+		return "{}", nil
+	}
+	encoded, err := json.Marshal(labels)
+	if err != nil {
+		return "", fmt.Errorf("pg.encodeLabels: %w", err)
 	}
+	return string(encoded), nil
 }
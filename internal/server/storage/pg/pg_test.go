@@ -2,16 +2,18 @@ package pg
 
 import (
 	"context"
-	"database/sql"
 	"testing"
 	"time"
 
-	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/stretchr/testify/require"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/modules/postgres"
 	"github.com/testcontainers/testcontainers-go/wait"
+	appErrors "github.com/ulixes-bloom/ya-metrics/internal/pkg/errors"
 	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+	"github.com/ulixes-bloom/ya-metrics/internal/server/config"
+	"github.com/ulixes-bloom/ya-metrics/internal/server/storage/storagetest"
 	"gotest.tools/v3/assert"
 )
 
@@ -21,7 +23,7 @@ func TestStorage_SetMetric(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), contextTimeout)
 	defer cancel()
 
-	storage, err := newPostgresStorage(ctx)
+	storage, err := newPostgresStorage(ctx, config.GetDefault())
 	require.NoError(t, err)
 
 	metric := metrics.NewGaugeMetric("gauge_test", 12.8)
@@ -32,14 +34,225 @@ func TestStorage_SetMetric(t *testing.T) {
 	assert.Equal(t, *metric.Value, *dbMetric.Value)
 	assert.Equal(t, metric.MType, dbMetric.MType)
 
-	dbMetric, err = storage.Get(ctx, metric.ID)
+	dbMetric, err = storage.Get(ctx, metric.ID, metric.Labels)
 	require.NoError(t, err)
 	assert.Equal(t, metric.ID, dbMetric.ID)
 	assert.Equal(t, *metric.Value, *dbMetric.Value)
 	assert.Equal(t, metric.MType, dbMetric.MType)
 }
 
-func newPostgresStorage(ctx context.Context) (*pgstorage, error) {
+func TestStorage_SetLabeledMetrics(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), contextTimeout)
+	defer cancel()
+
+	storage, err := newPostgresStorage(ctx, config.GetDefault())
+	require.NoError(t, err)
+
+	first := metrics.NewCounterMetric("counter_test", 1)
+	first.Labels = map[string]string{"host": "a"}
+	second := metrics.NewCounterMetric("counter_test", 5)
+	second.Labels = map[string]string{"host": "b"}
+
+	_, err = storage.SetAll(ctx, []metrics.Metric{first, second, first})
+	require.NoError(t, err)
+
+	dbMetric, err := storage.Get(ctx, first.ID, first.Labels)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), dbMetric.GetDelta())
+	assert.Equal(t, "a", dbMetric.Labels["host"])
+
+	dbMetric, err = storage.Get(ctx, second.ID, second.Labels)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), dbMetric.GetDelta())
+
+	_, err = storage.Get(ctx, first.ID, nil)
+	require.Error(t, err)
+}
+
+func TestStorage_SetHistogram(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), contextTimeout)
+	defer cancel()
+
+	storage, err := newPostgresStorage(ctx, config.GetDefault())
+	require.NoError(t, err)
+
+	histogram := metrics.NewHistogramMetric("histogram_test", []float64{1, 10})
+	histogram.Observe(5)
+
+	_, err = storage.Set(ctx, histogram)
+	require.NoError(t, err)
+	_, err = storage.SetAll(ctx, []metrics.Metric{histogram})
+	require.NoError(t, err)
+
+	dbMetric, err := storage.Get(ctx, histogram.ID, nil)
+	require.NoError(t, err)
+	assert.Equal(t, metrics.Histogram, dbMetric.MType)
+	assert.Equal(t, uint64(2), dbMetric.GetCount())
+	assert.Equal(t, float64(10), dbMetric.GetSum())
+	assert.DeepEqual(t, []metrics.Bucket{{UpperBound: 1, Count: 0}, {UpperBound: 10, Count: 2}}, dbMetric.Buckets)
+}
+
+func TestStorage_GetRange(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), contextTimeout)
+	defer cancel()
+
+	conf := config.GetDefault()
+	conf.HistoryEnabled = true
+	storage, err := newPostgresStorage(ctx, conf)
+	require.NoError(t, err)
+
+	from := time.Now()
+	_, err = storage.Set(ctx, metrics.NewCounterMetric("counter_test", 2))
+	require.NoError(t, err)
+	_, err = storage.SetAll(ctx, []metrics.Metric{metrics.NewCounterMetric("counter_test", 3)})
+	require.NoError(t, err)
+
+	samples, err := storage.GetRange(ctx, "counter_test", nil, from, time.Now())
+	require.NoError(t, err)
+	require.Len(t, samples, 2)
+	assert.Equal(t, float64(2), samples[0].Value)
+	assert.Equal(t, float64(5), samples[1].Value)
+}
+
+func TestStorage_Conformance(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), contextTimeout)
+	defer cancel()
+
+	storage, err := newPostgresStorage(ctx, config.GetDefault())
+	require.NoError(t, err)
+
+	storagetest.Run(t, storage)
+}
+
+func TestStorage_Migrations(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), contextTimeout)
+	defer cancel()
+
+	storage, err := newPostgresStorage(ctx, config.GetDefault())
+	require.NoError(t, err)
+
+	status, err := MigrationStatus(ctx, storage.pool)
+	require.NoError(t, err)
+	for _, m := range status {
+		assert.Assert(t, m.Applied)
+	}
+
+	// reverting the latest migration leaves it pending, applying again is possible
+	require.NoError(t, MigrateDown(ctx, storage.pool))
+	status, err = MigrationStatus(ctx, storage.pool)
+	require.NoError(t, err)
+	assert.Assert(t, !status[len(status)-1].Applied)
+
+	require.NoError(t, MigrateUp(ctx, storage.pool))
+	require.NoError(t, MigrateUp(ctx, storage.pool))
+	status, err = MigrationStatus(ctx, storage.pool)
+	require.NoError(t, err)
+	assert.Assert(t, status[len(status)-1].Applied)
+}
+
+func TestStorage_UpgradeBaselineSchema(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), contextTimeout)
+	defer cancel()
+
+	conf := config.GetDefault()
+	pool, err := newPostgresPool(ctx, conf)
+	require.NoError(t, err)
+
+	// the schema of databases created before labels and migrations were introduced
+	_, err = pool.Exec(ctx, `
+		CREATE TABLE metrics
+		(
+			id    varchar(255) PRIMARY KEY,
+			type  varchar(30) NOT NULL,
+			delta bigint,
+			value double precision
+		);
+		INSERT INTO metrics (id, type, delta) VALUES ('counter_test', 'counter', 2);`)
+	require.NoError(t, err)
+
+	storage, err := NewStorage(ctx, pool, conf)
+	require.NoError(t, err)
+
+	dbMetric, err := storage.Get(ctx, "counter_test", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), dbMetric.GetDelta())
+
+	labeled := metrics.NewCounterMetric("counter_test", 5)
+	labeled.Labels = map[string]string{"host": "a"}
+	_, err = storage.Set(ctx, labeled)
+	require.NoError(t, err)
+
+	histogram := metrics.NewHistogramMetric("histogram_test", []float64{1})
+	histogram.Observe(1)
+	_, err = storage.Set(ctx, histogram)
+	require.NoError(t, err)
+
+	dbMetric, err = storage.Get(ctx, "counter_test", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), dbMetric.GetDelta())
+	dbMetric, err = storage.Get(ctx, labeled.ID, labeled.Labels)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), dbMetric.GetDelta())
+}
+
+func TestMergeScalars(t *testing.T) {
+	labeled := metrics.NewCounterMetric("counter_test", 5)
+	labeled.Labels = map[string]string{"host": "a"}
+
+	merged, err := mergeScalars([]metrics.Metric{
+		metrics.NewCounterMetric("counter_test", 1),
+		metrics.NewGaugeMetric("gauge_test", 1),
+		labeled,
+		metrics.NewCounterMetric("counter_test", 2),
+		metrics.NewGaugeMetric("gauge_test", 3),
+	})
+	require.NoError(t, err)
+
+	require.Len(t, merged, 3)
+	assert.Equal(t, int64(3), merged[0].GetDelta())
+	assert.Equal(t, float64(3), merged[1].GetValue())
+	assert.Equal(t, int64(5), merged[2].GetDelta())
+
+	_, err = mergeScalars([]metrics.Metric{
+		metrics.NewCounterMetric("test", 1),
+		metrics.NewGaugeMetric("test", 1),
+	})
+	require.ErrorIs(t, err, appErrors.ErrMetricTypeMismatch)
+}
+
+func BenchmarkStorage_SetAll(b *testing.B) {
+	ctx, cancel := context.WithTimeout(context.Background(), contextTimeout)
+	defer cancel()
+
+	storage, err := newPostgresStorage(ctx, config.GetDefault())
+	require.NoError(b, err)
+
+	metricsToSet := []metrics.Metric{}
+	for _, v := range metrics.GaugeMetrics {
+		metricsToSet = append(metricsToSet, metrics.NewGaugeMetric(v, 1))
+	}
+	for _, v := range metrics.CounterMetrics {
+		metricsToSet = append(metricsToSet, metrics.NewCounterMetric(v, 1))
+	}
+
+	b.ResetTimer()
+	for range b.N {
+		if _, err := storage.SetAll(ctx, metricsToSet); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func newPostgresStorage(ctx context.Context, conf *config.Config) (*pgstorage, error) {
+	pool, err := newPostgresPool(ctx, conf)
+	if err != nil {
+		return nil, err
+	}
+	return NewStorage(ctx, pool, conf)
+}
+
+// newPostgresPool starts a database container and connects to it.
+func newPostgresPool(ctx context.Context, conf *config.Config) (*pgxpool.Pool, error) {
 	dbName := "gophermart"
 	dbUser := "user"
 	dbPassword := "password"
@@ -63,15 +276,6 @@ func newPostgresStorage(ctx context.Context) (*pgstorage, error) {
 		return nil, err
 	}
 
-	db, err := sql.Open("pgx", connStr)
-	if err != nil {
-		return nil, err
-	}
-
-	storage, err := NewStorage(ctx, db)
-	if err != nil {
-		return nil, err
-	}
-
-	return storage, err
+	conf.DatabaseDSN = connStr
+	return NewPool(ctx, conf)
 }
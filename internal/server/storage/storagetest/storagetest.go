@@ -0,0 +1,170 @@
+// Package storagetest provides the conformance tests shared by the server metrics storages.
+//
+// Every storage is expected to behave the same way through the service layer,
+// so its tests call Run with a storage created the way the server does.
+package storagetest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appErrors "github.com/ulixes-bloom/ya-metrics/internal/pkg/errors"
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+)
+
+// Storage is the part of the storage covered by the conformance tests.
+type Storage interface {
+	Get(ctx context.Context, id string, labels map[string]string) (metrics.Metric, error)
+	Set(ctx context.Context, metric metrics.Metric) (metrics.Metric, error)
+	SetAll(ctx context.Context, metricsSlice []metrics.Metric) ([]metrics.Metric, error)
+}
+
+// Run runs the conformance tests against the storage.
+// Tests use series of their own, so the storage may be shared with other tests.
+func Run(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	t.Run("Counter deltas are summed", func(t *testing.T) {
+		_, err := s.Set(ctx, metrics.NewCounterMetric("conformance_counter", 2))
+		require.NoError(t, err)
+		stored, err := s.Set(ctx, metrics.NewCounterMetric("conformance_counter", 3))
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), stored.GetDelta())
+
+		got, err := s.Get(ctx, "conformance_counter", nil)
+		require.NoError(t, err)
+		assert.Equal(t, metrics.Counter, got.MType)
+		assert.Equal(t, int64(5), got.GetDelta())
+	})
+
+	t.Run("Gauge value is replaced", func(t *testing.T) {
+		_, err := s.Set(ctx, metrics.NewGaugeMetric("conformance_gauge", 2))
+		require.NoError(t, err)
+		stored, err := s.Set(ctx, metrics.NewGaugeMetric("conformance_gauge", 1.5))
+		require.NoError(t, err)
+		assert.Equal(t, 1.5, stored.GetValue())
+
+		got, err := s.Get(ctx, "conformance_gauge", nil)
+		require.NoError(t, err)
+		assert.Equal(t, metrics.Gauge, got.MType)
+		assert.Equal(t, 1.5, got.GetValue())
+	})
+
+	t.Run("Labels identify series", func(t *testing.T) {
+		labeled := metrics.NewCounterMetric("conformance_labeled", 4)
+		labeled.Labels = map[string]string{"host": "a"}
+		_, err := s.SetAll(ctx, []metrics.Metric{
+			metrics.NewCounterMetric("conformance_labeled", 1),
+			labeled,
+		})
+		require.NoError(t, err)
+
+		got, err := s.Get(ctx, "conformance_labeled", map[string]string{"host": "a"})
+		require.NoError(t, err)
+		assert.Equal(t, int64(4), got.GetDelta())
+		assert.Equal(t, "a", got.Labels["host"])
+		got, err = s.Get(ctx, "conformance_labeled", nil)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), got.GetDelta())
+	})
+
+	t.Run("Missing series", func(t *testing.T) {
+		_, err := s.Get(ctx, "conformance_missing", nil)
+		assert.ErrorIs(t, err, appErrors.ErrMetricNotExists)
+	})
+
+	t.Run("Batch sums counters of the same series", func(t *testing.T) {
+		stored, err := s.SetAll(ctx, []metrics.Metric{
+			metrics.NewCounterMetric("conformance_batch", 1),
+			metrics.NewGaugeMetric("conformance_batch_gauge", 1),
+			metrics.NewCounterMetric("conformance_batch", 2),
+			metrics.NewGaugeMetric("conformance_batch_gauge", 3),
+		})
+		require.NoError(t, err)
+
+		// the latest returned state of a series is its stored state
+		latest := make(map[string]metrics.Metric)
+		for _, m := range stored {
+			latest[m.Key()] = m
+		}
+		counter, gauge := latest["conformance_batch"], latest["conformance_batch_gauge"]
+		assert.Equal(t, int64(3), counter.GetDelta())
+		assert.Equal(t, float64(3), gauge.GetValue())
+
+		got, err := s.Get(ctx, "conformance_batch", nil)
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), got.GetDelta())
+		got, err = s.Get(ctx, "conformance_batch_gauge", nil)
+		require.NoError(t, err)
+		assert.Equal(t, float64(3), got.GetValue())
+	})
+
+	t.Run("Type mismatch is rejected", func(t *testing.T) {
+		_, err := s.Set(ctx, metrics.NewCounterMetric("conformance_typed", 1))
+		require.NoError(t, err)
+
+		histogram := metrics.NewHistogramMetric("conformance_typed", []float64{1})
+		histogram.Observe(1)
+		for _, m := range []metrics.Metric{metrics.NewGaugeMetric("conformance_typed", 1), histogram} {
+			_, err = s.Set(ctx, m)
+			assert.ErrorIs(t, err, appErrors.ErrMetricTypeMismatch, m.MType)
+		}
+
+		got, err := s.Get(ctx, "conformance_typed", nil)
+		require.NoError(t, err)
+		assert.Equal(t, metrics.Counter, got.MType)
+		assert.Equal(t, int64(1), got.GetDelta())
+	})
+
+	t.Run("Batch with a type mismatch is rejected", func(t *testing.T) {
+		_, err := s.Set(ctx, metrics.NewGaugeMetric("conformance_typed_batch", 1))
+		require.NoError(t, err)
+
+		batches := [][]metrics.Metric{
+			// conflicts with the stored series
+			{
+				metrics.NewCounterMetric("conformance_untouched", 1),
+				metrics.NewCounterMetric("conformance_typed_batch", 1),
+			},
+			// conflicts within the batch
+			{
+				metrics.NewCounterMetric("conformance_untouched", 1),
+				metrics.NewCounterMetric("conformance_typed_new", 1),
+				metrics.NewGaugeMetric("conformance_typed_new", 1),
+			},
+		}
+		for _, batch := range batches {
+			_, err := s.SetAll(ctx, batch)
+			assert.ErrorIs(t, err, appErrors.ErrMetricTypeMismatch)
+		}
+
+		_, err = s.Get(ctx, "conformance_untouched", nil)
+		assert.ErrorIs(t, err, appErrors.ErrMetricNotExists)
+		got, err := s.Get(ctx, "conformance_typed_batch", nil)
+		require.NoError(t, err)
+		assert.Equal(t, float64(1), got.GetValue())
+	})
+
+	t.Run("Batch with a failing merge is rejected", func(t *testing.T) {
+		histogram := metrics.NewHistogramMetric("conformance_histogram", []float64{1})
+		histogram.Observe(1)
+		_, err := s.Set(ctx, histogram)
+		require.NoError(t, err)
+
+		rebucketed := metrics.NewHistogramMetric("conformance_histogram", []float64{1, 2})
+		rebucketed.Observe(1)
+		_, err = s.SetAll(ctx, []metrics.Metric{
+			metrics.NewCounterMetric("conformance_unmerged", 1),
+			rebucketed,
+		})
+		assert.ErrorIs(t, err, appErrors.ErrMetricValueNotValid)
+
+		_, err = s.Get(ctx, "conformance_unmerged", nil)
+		assert.ErrorIs(t, err, appErrors.ErrMetricNotExists)
+		got, err := s.Get(ctx, "conformance_histogram", nil)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1), got.GetCount())
+	})
+}
@@ -0,0 +1,18 @@
+package watcher
+
+import (
+	"context"
+	"time"
+
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+)
+
+type Storage interface {
+	Get(ctx context.Context, id string, labels map[string]string) (val metrics.Metric, err error)
+	GetAll(ctx context.Context) ([]metrics.Metric, error)
+	GetRange(ctx context.Context, id string, labels map[string]string, from, to time.Time) ([]metrics.Sample, error)
+	Set(ctx context.Context, metric metrics.Metric) (metrics.Metric, error)
+	SetAll(ctx context.Context, meticsSlice []metrics.Metric) ([]metrics.Metric, error)
+	Ping(ctx context.Context) error
+	Shutdown(ctx context.Context) error
+}
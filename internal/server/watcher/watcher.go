@@ -0,0 +1,112 @@
+// Package watcher wraps a metrics storage to notify subscribers about every metric written to it.
+//
+// Subscribers receive the stored state of a series after each update, e.g. the total value of
+// a counter rather than the delta being added. Updates are delivered through buffered channels;
+// if a subscriber falls behind, updates it has no room for are dropped.
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	"github.com/ulixes-bloom/ya-metrics/internal/pkg/metrics"
+)
+
+// subscriberBuffer is the number of updates buffered for every subscriber.
+const subscriberBuffer = 256
+
+type watcher struct {
+	Storage
+
+	subscribers map[int]chan metrics.Metric
+	nextID      int
+	mutex       sync.RWMutex
+}
+
+// New wraps the storage, the returned storage notifies subscribers on every successful write.
+func New(storage Storage) *watcher {
+	return &watcher{
+		Storage:     storage,
+		subscribers: make(map[int]chan metrics.Metric),
+	}
+}
+
+// Set stores the metric and notifies subscribers about the resulting state of the series.
+func (w *watcher) Set(ctx context.Context, metric metrics.Metric) (metrics.Metric, error) {
+	res, err := w.Storage.Set(ctx, metric)
+	if err != nil {
+		return res, fmt.Errorf("watcher.set: %w", err)
+	}
+
+	w.publish(res)
+	return res, nil
+}
+
+// SetAll stores the metrics and notifies subscribers about the resulting state of every updated series.
+func (w *watcher) SetAll(ctx context.Context, metricsSlice []metrics.Metric) ([]metrics.Metric, error) {
+	stored, err := w.Storage.SetAll(ctx, metricsSlice)
+	if err != nil {
+		return nil, fmt.Errorf("watcher.setAll: %w", err)
+	}
+
+	if !w.hasSubscribers() {
+		return stored, nil
+	}
+
+	// the same series may be updated several times within a batch, only its latest state is published
+	latest := make(map[string]int, len(stored))
+	for i, m := range stored {
+		latest[m.Key()] = i
+	}
+	for i, m := range stored {
+		if latest[m.Key()] == i {
+			w.publish(m)
+		}
+	}
+	return stored, nil
+}
+
+// Subscribe returns a channel receiving updated metrics until the returned cancel function is called.
+func (w *watcher) Subscribe() (<-chan metrics.Metric, func()) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	id := w.nextID
+	w.nextID++
+	ch := make(chan metrics.Metric, subscriberBuffer)
+	w.subscribers[id] = ch
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			w.mutex.Lock()
+			defer w.mutex.Unlock()
+
+			delete(w.subscribers, id)
+			close(ch)
+		})
+	}
+	return ch, cancel
+}
+
+func (w *watcher) hasSubscribers() bool {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+
+	return len(w.subscribers) > 0
+}
+
+func (w *watcher) publish(m metrics.Metric) {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+
+	for id, ch := range w.subscribers {
+		select {
+		case ch <- m:
+		default:
+			log.Warn().Int("subscriber", id).Str("metric", m.Key()).Msg("subscriber is too slow, update dropped")
+		}
+	}
+}